@@ -0,0 +1,263 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/docker/daemon/logger"
+)
+
+// lines held per paused sink before new lines are dropped
+var PAUSED_LINES_MAX = 10000
+
+// heldMessage is a CloudWatch Logs line held for a container while its log group is paused
+type heldMessage struct {
+	id  string
+	msg *logger.Message
+}
+
+// Serve an authenticated local admin API for live tuning without restarting the agent,
+// which would briefly drop logs for every container on the host
+// ADMIN_TOKEN=secret ADMIN_ADDR=127.0.0.1:8089
+func (m *Monitor) Admin() {
+	token := os.Getenv("ADMIN_TOKEN")
+
+	if token == "" {
+		m.logSystemf("admin at=end reason=unconfigured")
+		return
+	}
+
+	addr := os.Getenv("ADMIN_ADDR")
+	if addr == "" {
+		addr = "127.0.0.1:8089"
+	}
+
+	m.logSystemf("admin at=start addr=%s", addr)
+
+	err := http.ListenAndServe(addr, m.adminHandler(token))
+	if err != nil {
+		m.logSystemf("admin ListenAndServe addr=%s err=%q", addr, err)
+		m.ReportError(err)
+	}
+}
+
+func (m *Monitor) adminHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/level", m.adminLevel)
+	mux.HandleFunc("/apps/", m.adminApps)
+	mux.HandleFunc("/sinks/", m.adminSinks)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := []byte(r.Header.Get("Authorization"))
+
+		if subtle.ConstantTimeCompare(auth, []byte("Bearer "+token)) != 1 {
+			m.logSystemf("admin path=%s count#AdminUnauthorized=1", r.URL.Path)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method != "POST" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// POST /level level=debug adds verbose agent events, level=warn keeps only metrics
+func (m *Monitor) adminLevel(w http.ResponseWriter, r *http.Request) {
+	level, err := logrus.ParseLevel(r.FormValue("level"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	logrus.SetLevel(level)
+
+	m.logSystemf("who=\"convox/agent\" what=\"admin set log level to %s\"", level)
+	fmt.Fprintf(w, "level=%s\n", level)
+}
+
+// POST /apps/<app>/filter pattern=<regexp> drops matching lines, an empty pattern removes the filter
+// POST /apps/<app>/sample rate=<0-1> forwards a fraction of lines, rate=1 removes sampling
+func (m *Monitor) adminApps(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/apps/"), "/")
+
+	if len(parts) != 2 || parts[0] == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	app := parts[0]
+
+	switch parts[1] {
+	case "filter":
+		pattern := r.FormValue("pattern")
+
+		if pattern == "" {
+			m.setFilter(app, nil)
+			m.logSystemf("who=\"convox/agent\" what=\"admin removed %s filter\"", app)
+			fmt.Fprintf(w, "app=%s filter=none\n", app)
+			return
+		}
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		m.setFilter(app, re)
+		m.logSystemf("who=\"convox/agent\" what=\"admin set %s filter to %q\"", app, pattern)
+		fmt.Fprintf(w, "app=%s filter=%q\n", app, pattern)
+	case "sample":
+		rate, err := strconv.ParseFloat(r.FormValue("rate"), 64)
+		if err != nil || rate < 0 || rate > 1 {
+			http.Error(w, "rate must be between 0 and 1", http.StatusBadRequest)
+			return
+		}
+
+		m.setSample(app, rate)
+		m.logSystemf("who=\"convox/agent\" what=\"admin set %s sample rate to %g\"", app, rate)
+		fmt.Fprintf(w, "app=%s sample=%g\n", app, rate)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// POST /sinks/<stream or log group>/pause holds lines until resumed, up to PAUSED_LINES_MAX
+// POST /sinks/<stream or log group>/resume
+func (m *Monitor) adminSinks(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/sinks/"), "/")
+
+	if len(parts) != 2 || parts[0] == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	sink := parts[0]
+
+	switch parts[1] {
+	case "pause":
+		m.setPaused(sink, true)
+		m.logSystemf("who=\"convox/agent\" what=\"admin paused sink %s\"", sink)
+	case "resume":
+		m.setPaused(sink, false)
+		dropped := m.releaseMessages(sink)
+		m.logSystemf("who=\"convox/agent\" what=\"admin resumed sink %s\" sink=%s count#PausedLinesDropped=%d", sink, sink, dropped)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	fmt.Fprintf(w, "sink=%s %s=true\n", sink, parts[1])
+}
+
+// dropLine applies admin filters and sampling for an app
+func (m *Monitor) dropLine(app, line string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if re, ok := m.filters[app]; ok && re.MatchString(line) {
+		return true
+	}
+
+	if rate, ok := m.samples[app]; ok && rand.Float64() >= rate {
+		return true
+	}
+
+	return false
+}
+
+func (m *Monitor) setFilter(app string, re *regexp.Regexp) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if re == nil {
+		delete(m.filters, app)
+	} else {
+		m.filters[app] = re
+	}
+}
+
+func (m *Monitor) setSample(app string, rate float64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if rate >= 1 {
+		delete(m.samples, app)
+	} else {
+		m.samples[app] = rate
+	}
+}
+
+func (m *Monitor) isPaused(sink string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.paused[sink]
+}
+
+func (m *Monitor) setPaused(sink string, paused bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if paused {
+		m.paused[sink] = true
+	} else {
+		delete(m.paused, sink)
+	}
+}
+
+// holdMessage queues a line if its log group is paused, returning false if it should be sent now
+func (m *Monitor) holdMessage(id, logGroup string, msg *logger.Message) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if !m.paused[logGroup] {
+		return false
+	}
+
+	if len(m.held[logGroup]) >= PAUSED_LINES_MAX {
+		m.dropped[logGroup] += 1
+	} else {
+		m.held[logGroup] = append(m.held[logGroup], heldMessage{id, msg})
+	}
+
+	return true
+}
+
+// releaseMessages sends lines held for a resumed log group, returning how many lines
+// were dropped for the sink while it was paused
+func (m *Monitor) releaseMessages(sink string) int {
+	m.lock.Lock()
+	held := m.held[sink]
+	dropped := m.dropped[sink]
+	delete(m.held, sink)
+	delete(m.dropped, sink)
+	m.lock.Unlock()
+
+	for _, h := range held {
+		awslogger, ok := m.getLogger(h.id)
+		if !ok {
+			// the container exited and its logger closed while paused
+			dropped += 1
+			continue
+		}
+
+		if err := awslogger.Log(h.msg); err != nil {
+			m.logSystemf("admin releaseMessages sink=%s awslogger.Log err=%q", sink, err)
+		}
+	}
+
+	return dropped
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/docker/docker/daemon/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+// testLogger records lines instead of sending them to CloudWatch Logs
+type testLogger struct {
+	lines []string
+}
+
+func (l *testLogger) Log(msg *logger.Message) error {
+	l.lines = append(l.lines, string(msg.Line))
+	return nil
+}
+
+func (l *testLogger) Name() string { return "test" }
+func (l *testLogger) Close() error { return nil }
+
+// captureStdout returns what f prints to stdout
+func captureStdout(t *testing.T, f func()) string {
+	r, w, err := os.Pipe()
+	assert.Nil(t, err)
+
+	stdout := os.Stdout
+	os.Stdout = w
+
+	f()
+
+	os.Stdout = stdout
+	w.Close()
+
+	out, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+
+	return string(out)
+}
+
+func adminRequest(t *testing.T, h http.Handler, token, path string, form url.Values) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	assert.Nil(t, err)
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestAdmin(t *testing.T) {
+	m := &Monitor{
+		filters: make(map[string]*regexp.Regexp),
+		samples: make(map[string]float64),
+		paused:  make(map[string]bool),
+	}
+
+	h := m.adminHandler("secret")
+
+	w := adminRequest(t, h, "", "/sinks/myapp-Kinesis-L6MUKT1VH451/pause", nil)
+	assert.Equal(t, 401, w.Code)
+
+	w = adminRequest(t, h, "wrong", "/sinks/myapp-Kinesis-L6MUKT1VH451/pause", nil)
+	assert.Equal(t, 401, w.Code)
+	assert.False(t, m.isPaused("myapp-Kinesis-L6MUKT1VH451"))
+
+	w = adminRequest(t, h, "secret", "/sinks/myapp-Kinesis-L6MUKT1VH451/pause", nil)
+	assert.Equal(t, 200, w.Code)
+	assert.True(t, m.isPaused("myapp-Kinesis-L6MUKT1VH451"))
+
+	w = adminRequest(t, h, "secret", "/sinks/myapp-Kinesis-L6MUKT1VH451/resume", nil)
+	assert.Equal(t, 200, w.Code)
+	assert.False(t, m.isPaused("myapp-Kinesis-L6MUKT1VH451"))
+
+	w = adminRequest(t, h, "secret", "/apps/myapp/filter", url.Values{"pattern": {"GET /health"}})
+	assert.Equal(t, 200, w.Code)
+	assert.True(t, m.dropLine("myapp", "GET /health 200"))
+	assert.False(t, m.dropLine("myapp", "GET / 200"))
+	assert.False(t, m.dropLine("other", "GET /health 200"))
+
+	w = adminRequest(t, h, "secret", "/apps/myapp/filter", url.Values{"pattern": {""}})
+	assert.Equal(t, 200, w.Code)
+	assert.False(t, m.dropLine("myapp", "GET /health 200"))
+
+	w = adminRequest(t, h, "secret", "/apps/myapp/sample", url.Values{"rate": {"0"}})
+	assert.Equal(t, 200, w.Code)
+	assert.True(t, m.dropLine("myapp", "GET / 200"))
+
+	w = adminRequest(t, h, "secret", "/apps/myapp/sample", url.Values{"rate": {"2"}})
+	assert.Equal(t, 400, w.Code)
+
+	w = adminRequest(t, h, "secret", "/level", url.Values{"level": {"loud"}})
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestAdminLevel(t *testing.T) {
+	defer logrus.SetLevel(logrus.GetLevel())
+
+	m := &Monitor{}
+	h := m.adminHandler("secret")
+
+	emit := func() string {
+		return captureStdout(t, func() {
+			m.logDebugf("debug event")
+			m.logSystemf("info event")
+			m.logSystemf("count#Metric=1")
+		})
+	}
+
+	w := adminRequest(t, h, "secret", "/level", url.Values{"level": {"debug"}})
+	assert.Equal(t, 200, w.Code)
+
+	out := emit()
+	assert.Contains(t, out, "debug event")
+	assert.Contains(t, out, "info event")
+	assert.Contains(t, out, "count#Metric=1")
+
+	w = adminRequest(t, h, "secret", "/level", url.Values{"level": {"info"}})
+	assert.Equal(t, 200, w.Code)
+
+	out = emit()
+	assert.NotContains(t, out, "debug event")
+	assert.Contains(t, out, "info event")
+
+	w = adminRequest(t, h, "secret", "/level", url.Values{"level": {"warn"}})
+	assert.Equal(t, 200, w.Code)
+
+	out = emit()
+	assert.NotContains(t, out, "info event")
+	assert.Contains(t, out, "count#Metric=1")
+}
+
+func TestAdminPause(t *testing.T) {
+	max := PAUSED_LINES_MAX
+	defer func() { PAUSED_LINES_MAX = max }()
+
+	PAUSED_LINES_MAX = 2
+
+	l := &testLogger{}
+
+	m := &Monitor{
+		envs: map[string]map[string]string{
+			"977a93d4d48e": {"KINESIS": "myapp-Kinesis-L6MUKT1VH451", "LOG_GROUP": "myapp-LogGroup-9I65CAJ6OLO9", "PROCESS": "web"},
+		},
+		lines:   make(map[string][]*kinesis.PutRecordsRequestEntry),
+		loggers: map[string]logger.Logger{"977a93d4d48e": l},
+		paused:  make(map[string]bool),
+		held:    make(map[string][]heldMessage),
+		dropped: make(map[string]int),
+	}
+
+	h := m.adminHandler("secret")
+
+	adminRequest(t, h, "secret", "/sinks/myapp-LogGroup-9I65CAJ6OLO9/pause", nil)
+	adminRequest(t, h, "secret", "/sinks/myapp-Kinesis-L6MUKT1VH451/pause", nil)
+
+	for _, line := range []string{"one", "two", "three"} {
+		m.logAppEvent("977a93d4d48e", line)
+	}
+
+	assert.Len(t, l.lines, 0)
+	assert.Len(t, m.lines["myapp-Kinesis-L6MUKT1VH451"], 2)
+
+	out := captureStdout(t, func() {
+		adminRequest(t, h, "secret", "/sinks/myapp-LogGroup-9I65CAJ6OLO9/resume", nil)
+		adminRequest(t, h, "secret", "/sinks/myapp-Kinesis-L6MUKT1VH451/resume", nil)
+	})
+
+	assert.Len(t, l.lines, 2)
+	assert.Contains(t, l.lines[0], "one")
+	assert.Contains(t, l.lines[1], "two")
+	assert.Contains(t, out, "sink=myapp-LogGroup-9I65CAJ6OLO9 count#PausedLinesDropped=1")
+	assert.Contains(t, out, "sink=myapp-Kinesis-L6MUKT1VH451 count#PausedLinesDropped=1")
+
+	m.logAppEvent("977a93d4d48e", "four")
+	assert.Len(t, l.lines, 3)
+
+	// lines held for a container that exits while paused are counted as dropped
+	adminRequest(t, h, "secret", "/sinks/myapp-LogGroup-9I65CAJ6OLO9/pause", nil)
+	m.logAppEvent("977a93d4d48e", "five")
+	m.deleteLogger("977a93d4d48e")
+
+	out = captureStdout(t, func() {
+		adminRequest(t, h, "secret", "/sinks/myapp-LogGroup-9I65CAJ6OLO9/resume", nil)
+	})
+
+	assert.Len(t, l.lines, 3)
+	assert.Contains(t, out, "sink=myapp-LogGroup-9I65CAJ6OLO9 count#PausedLinesDropped=1")
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -27,6 +28,7 @@ func (m *Monitor) Containers() {
 
 	go m.handleEvents(ch)
 	go m.streamLogs()
+	go m.streamOrderedLogs()
 
 	// HACK: Range over instrumentation messages channel added to awslogs package
 	go func() {
@@ -35,6 +37,17 @@ func (m *Monitor) Containers() {
 		}
 	}()
 
+	// HACK: Range over delivery results channel added to awslogs package
+	go func() {
+		for r := range awslogs.ConvoxPublishResults {
+			if r.Err != nil {
+				m.slo.Record("cloudwatch:"+r.LogGroupName, 0, r.Events, time.Now())
+			} else {
+				m.slo.Record("cloudwatch:"+r.LogGroupName, r.Events, 0, time.Now())
+			}
+		}
+	}()
+
 	m.client.AddEventListener(ch)
 }
 
@@ -159,6 +172,16 @@ func (m *Monitor) handleCreate(id string) {
 	logDriver := container.HostConfig.LogConfig.Type
 	m.setLogDriver(id, logDriver)
 
+	if env["SCRUB_PII"] != "" {
+		scrubbers, unknown := parseScrubbers(env["SCRUB_PII"])
+
+		if len(unknown) > 0 {
+			m.logSystemf("container handleCreate id=%s SCRUB_PII=%q unknown=%q count#ScrubPIIUnknownKind=1 using=all", id, env["SCRUB_PII"], strings.Join(unknown, ","))
+		}
+
+		m.setScrubbers(id, scrubbers)
+	}
+
 	// create a an awslogger and associated CloudWatch Logs LogGroup
 	if logDriver == "json-file" && env["LOG_GROUP"] != "" {
 		awslogger, aerr := m.StartAWSLogger(container, env["LOG_GROUP"])
@@ -170,6 +193,11 @@ func (m *Monitor) handleCreate(id string) {
 		}
 	}
 
+	// containers starting in a warm pool are noise for app logs, failures still get through
+	if m.isWarm() {
+		return
+	}
+
 	msg := fmt.Sprintf("Starting process %s", id[0:12])
 	if p := env["PROCESS"]; p != "" {
 		msg = fmt.Sprintf("Starting %s process %s", p, id[0:12])
@@ -194,6 +222,8 @@ func (m *Monitor) handleDie(id string) {
 	}
 
 	m.logAppEvent(id, msg)
+
+	m.exitOrderedQueue(id)
 }
 
 func (m *Monitor) handleKill(id string) {
@@ -303,7 +333,13 @@ retry:
 		r, w := io.Pipe()
 
 		go m.readLines(id, r, wg, exit)
-		go m.followDockerLogs(id, w, wg, exit)
+
+		// high-throughput containers can opt in to reading json-file logs from disk
+		if env, _ := m.getEnv(id); env["LOG_READER"] == "file" {
+			go m.followJSONFile(id, w, wg, exit)
+		} else {
+			go m.followDockerLogs(id, w, wg, exit)
+		}
 
 		wg.Wait()
 
@@ -335,7 +371,8 @@ retry:
 		}
 	}
 
-	if awslogger, ok := m.getLogger(id); ok {
+	// forget the logger first so lines held for a paused group are counted as dropped rather than sent to a closed stream
+	if awslogger, ok := m.deleteLogger(id); ok {
 		err := awslogger.Close()
 		if err != nil {
 			m.logSystemf("container subscribeLogs id=%s awslogger.Close err=%q", id, err)
@@ -345,6 +382,9 @@ retry:
 		}
 	}
 
+	// every line has been read, start the clock on removing the ordered queue
+	m.exitOrderedQueue(id)
+
 	m.logSystemf("container subscribeLogs id=%s at=end", id)
 }
 
@@ -422,52 +462,96 @@ func (m *Monitor) parseAndForwardLine(id, line string) {
 
 	env, _ := m.getEnv(id)
 
-	app := env["APP"]
-	kinesis := env["KINESIS"]
+	app := appName(env)
 	logGroup := env["LOG_GROUP"]
 	process := env["PROCESS"]
 	release := env["RELEASE"]
 
-	// if APP is not available for legacy reasons, fall back to inferring from LOG_GROUP or KINESIS
-	if app == "" {
-		logResource := logGroup
-		if logGroup == "" {
-			logResource = kinesis
-		}
+	// count all lines we got from Docker
+	// m.logSystemf("container subscribeLogs parseAndForwardLine id=%s dim#app=%s count#Lines=1", id, app)
 
-		// extract app name from log resource
-		// convox-httpd-LogGroup-1KIJO8SS9F3Q9 -> convox-httpd
-		// myapp-staging-Kinesis-L6MUKT1VH451 -> myapp-staging
-		parts := strings.Split(logResource, "-")
-		if len(parts) > 2 {
-			app = strings.Join(parts[0:len(parts)-2], "-") // drop -LogGroup-YXXX
-		}
+	// apply filters and sampling set via the admin API
+	if m.dropLine(app, line) {
+		m.logDebugf("container subscribeLogs parseAndForwardLine id=%s app=%s dropped=true", id, app)
+		return
 	}
 
-	// count all lines we got from Docker
-	// m.logSystemf("container subscribeLogs parseAndForwardLine id=%s dim#app=%s count#Lines=1", id, app)
+	// redact PII before the line reaches any sink
+	if scrubbers, ok := m.getScrubbers(id); ok {
+		line = scrubLine(scrubbers, line)
+	}
+
+	// the app's own line, for partition keys that shouldn't vary with framing or timestamps
+	appLine := line
+
+	// optionally lead with tenant tags when TENANT_PREFIX=true, after scrubbing so an email client id survives
+	// [clientId=dev@convox.com environment=staging] Hello from Docker.
+	line = m.tagPrefix() + line
 
 	// append syslog-ish prefix:
 	// web:RXZMCQEPDKO/1d11a78279e0 Hello from Docker.
 	l := fmt.Sprintf("%s:%s/%s %s", process, release, id[0:12], line)
 
-	if awslogger, ok := m.getLogger(id); ok {
-		err := awslogger.Log(&logger.Message{
-			ContainerID: id,
-			Line:        []byte(l),
-			Timestamp:   ts,
-		})
-		if err != nil {
-			m.logSystemf("container subscribeLogs awslogger.Log err=%q", err)
-		}
+	// add timestamp to kinesis for legacy purposes
+	kl := fmt.Sprintf("%s %s", ts.Format("2006-01-02 15:04:05"), l)
+
+	// or frame like Heroku logplex so existing drains and parsers keep working
+	// 75 <190>1 2016-05-16T21:01:54.123456+00:00 host app web.1 - Hello from Docker.
+	if env["LOG_FORMAT"] == "logplex" {
+		l = formatLogplex(ts, "app", logplexDyno(process), line)
+		kl = l
 	}
 
+	m.logContainerMessage(id, logGroup, &logger.Message{
+		ContainerID: id,
+		Line:        []byte(l),
+		Timestamp:   ts,
+	})
+
 	if k := env["KINESIS"]; k != "" {
-		// add timestamp to kinesis for legacy purposes
-		m.addLine(k, []byte(fmt.Sprintf("%s %s", ts.Format("2006-01-02 15:04:05"), l)))
+		m.addContainerLine(id, k, appLine, []byte(kl))
+	}
+}
+
+// logContainerMessage sends a line to a container's CloudWatch Logs group, or holds it while the group is paused via the admin API
+func (m *Monitor) logContainerMessage(id, logGroup string, msg *logger.Message) {
+	awslogger, ok := m.getLogger(id)
+	if !ok {
+		return
+	}
+
+	if m.holdMessage(id, logGroup, msg) {
+		return
+	}
+
+	err := awslogger.Log(msg)
+	if err != nil {
+		m.logSystemf("container subscribeLogs awslogger.Log err=%q", err)
 	}
 }
 
+// appName returns a container's APP, or if it is not available for legacy reasons, infers it from LOG_GROUP or KINESIS
+func appName(env map[string]string) string {
+	if app := env["APP"]; app != "" {
+		return app
+	}
+
+	logResource := env["LOG_GROUP"]
+	if logResource == "" {
+		logResource = env["KINESIS"]
+	}
+
+	// extract app name from log resource
+	// convox-httpd-LogGroup-1KIJO8SS9F3Q9 -> convox-httpd
+	// myapp-staging-Kinesis-L6MUKT1VH451 -> myapp-staging
+	parts := strings.Split(logResource, "-")
+	if len(parts) > 2 {
+		return strings.Join(parts[0:len(parts)-2], "-") // drop -LogGroup-YXXX
+	}
+
+	return ""
+}
+
 func (m *Monitor) StartAWSLogger(container *docker.Container, logGroup string) (logger.Logger, error) {
 	ctx := logger.Context{
 		Config: map[string]string{
@@ -500,44 +584,71 @@ func (m *Monitor) streamLogs() {
 
 	for _ = range time.Tick(100 * time.Millisecond) {
 		for _, stream := range m.streams() {
-			l := m.getLines(stream)
-
-			if l == nil {
+			// hold lines for streams paused via the admin API
+			if m.isPaused(stream) {
 				continue
 			}
 
-			records := &kinesis.PutRecordsInput{
-				Records:    make([]*kinesis.PutRecordsRequestEntry, len(l)),
-				StreamName: aws.String(stream),
-			}
+			m.putLines(Kinesis, stream)
+		}
+	}
+}
 
-			for i, line := range l {
-				records.Records[i] = &kinesis.PutRecordsRequestEntry{
-					Data:         line,
-					PartitionKey: aws.String(string(time.Now().UnixNano())),
-				}
-			}
+// flushLines sends every queued line now instead of waiting on streamLogs
+func (m *Monitor) flushLines(Kinesis *kinesis.Kinesis) {
+	for _, stream := range m.streams() {
+		if m.isPaused(stream) {
+			continue
+		}
 
-			res, err := Kinesis.PutRecords(records)
-			if err != nil {
-				m.logSystemf("container streamLogs stream=%s count#KinesisPutRecordsError=1 err=%q", stream, err)
-			}
+		for m.putLines(Kinesis, stream) {
+		}
+	}
 
-			errorCount := 0
-			errorMsg := ""
+	for _, id := range m.orderedContainers() {
+		m.putOrderedLines(Kinesis, id)
+	}
+}
 
-			for _, r := range res.Records {
-				if r.ErrorCode != nil {
-					errorCount += 1
-					errorMsg = fmt.Sprintf("%s - %s", *r.ErrorCode, *r.ErrorMessage)
-				}
-			}
+// putLines sends a batch of queued lines to a stream, returning false when nothing was queued
+func (m *Monitor) putLines(Kinesis *kinesis.Kinesis, stream string) bool {
+	l := m.getLines(stream)
 
-			if errorCount > 0 {
-				m.logSystemf("container streamLogs stream=%s count#KinesisRecordsSuccesses=%d count#KinesisRecordsErrors=%d err=%q", stream, len(res.Records), errorCount, errorMsg)
-			}
+	if l == nil {
+		return false
+	}
+
+	records := &kinesis.PutRecordsInput{
+		Records:    l,
+		StreamName: aws.String(stream),
+	}
+
+	res, err := Kinesis.PutRecords(records)
+	if err != nil {
+		m.logSystemf("container streamLogs stream=%s count#KinesisPutRecordsError=1 err=%q", stream, err)
+		m.slo.Record("kinesis:"+stream, 0, len(l), time.Now())
+		return true
+	}
+
+	errorCount := 0
+	errorMsg := ""
+
+	for _, r := range res.Records {
+		if r.ErrorCode != nil {
+			errorCount += 1
+			errorMsg = fmt.Sprintf("%s - %s", *r.ErrorCode, *r.ErrorMessage)
 		}
 	}
+
+	if errorCount > 0 {
+		m.logSystemf("container streamLogs stream=%s count#KinesisRecordsSuccesses=%d count#KinesisRecordsErrors=%d err=%q", stream, len(res.Records), errorCount, errorMsg)
+	}
+
+	m.logDebugf("container streamLogs stream=%s records=%d errors=%d", stream, len(res.Records), errorCount)
+
+	m.slo.Record("kinesis:"+stream, len(res.Records)-errorCount, errorCount, time.Now())
+
+	return true
 }
 
 func (m *Monitor) getEnv(id string) (map[string]string, bool) {
@@ -570,6 +681,21 @@ func (m *Monitor) setEnv(id string, env map[string]string) {
 	m.envs[id] = env
 }
 
+func (m *Monitor) getScrubbers(id string) ([]scrubber, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	s, ok := m.scrubbers[id]
+	return s, ok
+}
+
+func (m *Monitor) setScrubbers(id string, s []scrubber) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.scrubbers[id] = s
+}
+
 func (m *Monitor) getLogger(id string) (logger.Logger, bool) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
@@ -585,14 +711,32 @@ func (m *Monitor) setLogger(id string, l logger.Logger) {
 	m.loggers[id] = l
 }
 
-func (m *Monitor) addLine(stream string, data []byte) {
+func (m *Monitor) deleteLogger(id string) (logger.Logger, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	l, ok := m.loggers[id]
+	delete(m.loggers, id)
+	return l, ok
+}
+
+func (m *Monitor) addLine(stream string, data []byte, partitionKey string) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
-	m.lines[stream] = append(m.lines[stream], data)
+	// bound memory while a stream is paused via the admin API
+	if m.paused[stream] && len(m.lines[stream]) >= PAUSED_LINES_MAX {
+		m.dropped[stream] += 1
+		return
+	}
+
+	m.lines[stream] = append(m.lines[stream], &kinesis.PutRecordsRequestEntry{
+		Data:         data,
+		PartitionKey: aws.String(partitionKey),
+	})
 }
 
-func (m *Monitor) getLines(stream string) [][]byte {
+func (m *Monitor) getLines(stream string) []*kinesis.PutRecordsRequestEntry {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
@@ -606,13 +750,36 @@ func (m *Monitor) getLines(stream string) [][]byte {
 		nl = 500
 	}
 
-	ret := make([][]byte, nl)
+	ret := make([]*kinesis.PutRecordsRequestEntry, nl)
 	copy(ret, m.lines[stream])
 	m.lines[stream] = m.lines[stream][nl:]
 
 	return ret
 }
 
+// logGroups returns the agent and container CloudWatch Logs groups
+func (m *Monitor) logGroups() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	groups := []string{}
+	seen := map[string]bool{}
+
+	if g := os.Getenv("LOG_GROUP"); g != "" {
+		groups = append(groups, g)
+		seen[g] = true
+	}
+
+	for _, env := range m.envs {
+		if g := env["LOG_GROUP"]; g != "" && !seen[g] {
+			groups = append(groups, g)
+			seen[g] = true
+		}
+	}
+
+	return groups
+}
+
 func (m *Monitor) streams() []string {
 	m.lock.Lock()
 	defer m.lock.Unlock()
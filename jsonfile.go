@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+var JSON_FILE_POLL_INTERVAL = 250 * time.Millisecond
+var JSON_FILE_RUNNING_INTERVAL = 5 * time.Second
+
+// host root is mounted into the agent container
+var JSON_FILE_ROOT = "/mnt/host_root"
+
+// followJSONFile is an alternative to followDockerLogs for containers with LOG_READER=file
+// It tails /var/lib/docker/containers/<id>/<id>-json.log directly, bypassing the Docker API
+// which becomes a bottleneck and drops lines at very high rates
+func (m *Monitor) followJSONFile(id string, w *io.PipeWriter, wg *sync.WaitGroup, exit chan bool) {
+	m.logSystemf("container subscribeLogs followJSONFile id=%s at=start", id)
+
+	path := fmt.Sprintf("/var/lib/docker/containers/%s/%s-json.log", id, id)
+
+	if c, err := m.client.InspectContainer(id); err == nil && c.LogPath != "" {
+		path = c.LogPath
+	}
+
+	// fall back to the Docker API if the file isn't reachable, e.g. host root isn't mounted
+	f, err := os.Open(JSON_FILE_ROOT + path)
+	if err != nil {
+		m.logSystemf("container subscribeLogs followJSONFile id=%s count#JSONFileOpenError=1 err=%q", id, err)
+		m.followDockerLogs(id, w, wg, exit)
+		return
+	}
+
+	defer wg.Done()
+
+	running := func() bool {
+		c, err := m.client.InspectContainer(id)
+
+		switch err.(type) {
+		case nil:
+			return c.State.Running
+		case *docker.NoSuchContainer:
+			return false
+		default:
+			return true
+		}
+	}
+
+	err = tailJSONFile(f, JSON_FILE_ROOT+path, w, running)
+	if err != nil {
+		m.logSystemf("container subscribeLogs followJSONFile id=%s count#JSONFileLogsError=1 err=%q", id, err)
+	}
+
+	err = w.Close()
+	if err != nil {
+		m.logSystemf("container subscribeLogs w.Close id=%s count#JSONFileLogsError=1", id)
+	}
+
+	close(exit)
+
+	m.logSystemf("container subscribeLogs followJSONFile id=%s at=end", id)
+}
+
+type jsonFileEntry struct {
+	Log    string    `json:"log"`
+	Stream string    `json:"stream"`
+	Time   time.Time `json:"time"`
+}
+
+type jsonFileTail struct {
+	path    string
+	f       *os.File
+	br      *bufio.Reader
+	partial []byte
+	w       io.Writer
+}
+
+// tailJSONFile follows a json-file log opened from path from its current end, reopening
+// it when Docker rotates it, until the container stops and the file is drained.
+// Lines are written to w in the `docker logs --timestamps` format that readLines expects.
+func tailJSONFile(f *os.File, path string, w io.Writer, running func() bool) error {
+	if _, err := f.Seek(0, os.SEEK_END); err != nil {
+		f.Close()
+		return err
+	}
+
+	t := &jsonFileTail{path: path, f: f, br: bufio.NewReader(f), w: w}
+	defer func() { t.f.Close() }()
+
+	checked := time.Now()
+
+	for {
+		if err := t.read(); err != nil {
+			return err
+		}
+
+		if t.rotated() {
+			nf, err := os.Open(path)
+			if err == nil {
+				// pick up anything written to the old file while it was being rotated
+				if err := t.read(); err != nil {
+					nf.Close()
+					return err
+				}
+
+				t.f.Close()
+				t.f = nf
+				t.br = bufio.NewReader(nf)
+				t.partial = nil
+				continue
+			}
+		}
+
+		if time.Since(checked) > JSON_FILE_RUNNING_INTERVAL {
+			checked = time.Now()
+
+			if !running() {
+				return t.read()
+			}
+		}
+
+		time.Sleep(JSON_FILE_POLL_INTERVAL)
+	}
+}
+
+// read forwards every complete line up to the end of the file
+func (t *jsonFileTail) read() error {
+	for {
+		b, err := t.br.ReadBytes('\n')
+		t.partial = append(t.partial, b...)
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		var e jsonFileEntry
+
+		if err := json.Unmarshal(t.partial, &e); err == nil {
+			if _, err := fmt.Fprintf(t.w, "%s %s\n", e.Time.Format(time.RFC3339Nano), strings.TrimSuffix(e.Log, "\n")); err != nil {
+				return err
+			}
+		}
+
+		t.partial = nil
+	}
+}
+
+// rotated reports if the file at path was replaced or truncated since it was opened
+func (t *jsonFileTail) rotated() bool {
+	fi, err := os.Stat(t.path)
+	if err != nil {
+		return false
+	}
+
+	cur, err := t.f.Stat()
+	if err != nil {
+		return false
+	}
+
+	offset, err := t.f.Seek(0, os.SEEK_CUR)
+	if err != nil {
+		return false
+	}
+
+	return !os.SameFile(fi, cur) || fi.Size() < offset
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type syncBuffer struct {
+	sync.Mutex
+	bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.Buffer.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+	return b.Buffer.String()
+}
+
+func TestTailJSONFile(t *testing.T) {
+	poll, run := JSON_FILE_POLL_INTERVAL, JSON_FILE_RUNNING_INTERVAL
+	defer func() {
+		JSON_FILE_POLL_INTERVAL, JSON_FILE_RUNNING_INTERVAL = poll, run
+	}()
+
+	JSON_FILE_POLL_INTERVAL = 5 * time.Millisecond
+	JSON_FILE_RUNNING_INTERVAL = 5 * time.Millisecond
+
+	dir, err := ioutil.TempDir("", "agent")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "8dfafdbc3a40-json.log")
+
+	appendLine := func(line string) {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		assert.Nil(t, err)
+		f.WriteString(line + "\n")
+		f.Close()
+	}
+
+	appendLine(`{"log":"before tail\n","stream":"stdout","time":"2016-05-16T21:01:53.000000001Z"}`)
+
+	var mu sync.Mutex
+	running := true
+
+	out := &syncBuffer{}
+	done := make(chan error)
+
+	f, err := os.Open(path)
+	assert.Nil(t, err)
+
+	go func() {
+		done <- tailJSONFile(f, path, out, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return running
+		})
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+
+	appendLine(`{"log":"Hello from Docker.\n","stream":"stdout","time":"2016-05-16T21:01:54.123456789Z"}`)
+
+	time.Sleep(50 * time.Millisecond)
+
+	// rotate like the json-file driver: rename and start a new file
+	assert.Nil(t, os.Rename(path, path+".1"))
+	appendLine(`{"log":"after rotate\n","stream":"stderr","time":"2016-05-16T21:01:55Z"}`)
+
+	time.Sleep(50 * time.Millisecond)
+
+	mu.Lock()
+	running = false
+	mu.Unlock()
+
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("tailJSONFile did not return after container stopped")
+	}
+
+	assert.Equal(t, "2016-05-16T21:01:54.123456789Z Hello from Docker.\n2016-05-16T21:01:55Z after rotate\n", out.String())
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+// Watch the Auto Scaling target lifecycle state
+// In a warm pool (Warmed:Stopped, Warmed:Running) suppress noisy container startup events
+// When an instance refresh replaces the instance (Terminated) drain ECS tasks and flush queued lines
+func (m *Monitor) Lifecycle() {
+	m.logSystemf("lifecycle at=start state=%q", m.getLifecycleState())
+
+	cfg := ec2metadata.Config{}
+
+	if os.Getenv("EC2_METADATA_ENDPOINT") != "" {
+		cfg.Endpoint = aws.String(os.Getenv("EC2_METADATA_ENDPOINT"))
+	}
+
+	svc := ec2metadata.New(&cfg)
+
+	Kinesis := kinesis.New(&aws.Config{})
+
+	for _ = range time.Tick(5 * time.Second) {
+		if os.Getenv("DEVELOPMENT") != "true" && svc.Available() {
+			state, err := svc.GetMetadata("autoscaling/target-lifecycle-state")
+			if err != nil {
+				continue // not in an Auto Scaling group that exposes lifecycle state
+			}
+
+			m.handleLifecycleState(Kinesis, state)
+		}
+	}
+}
+
+func (m *Monitor) handleLifecycleState(Kinesis *kinesis.Kinesis, state string) {
+	prev := m.getLifecycleState()
+
+	if state == prev {
+		return
+	}
+
+	m.setLifecycleState(state)
+	m.logSystemf("lifecycle state=%s prev=%s count#LifecycleStateChange=1", state, prev)
+
+	if state == "Terminated" {
+		// log for humans
+		m.logSystemf("who=\"convox/agent\" what=\"draining instance %s\" why=\"lifecycle state %s\"", m.instanceId, state)
+
+		// flush before draining so queued lines are sent even if the instance goes away mid-drain
+		m.flushLines(Kinesis)
+		m.drainInstance()
+	}
+}
+
+// isWarm reports if the instance is waiting in an Auto Scaling warm pool
+func (m *Monitor) isWarm() bool {
+	return strings.HasPrefix(m.getLifecycleState(), "Warmed:")
+}
+
+func (m *Monitor) getLifecycleState() string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.lifecycleState
+}
+
+func (m *Monitor) setLifecycleState(state string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.lifecycleState = state
+}
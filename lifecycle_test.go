@@ -0,0 +1,148 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/convox/rack/api/awsutil"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+// testKinesis serves PutRecord and PutRecords, recording each call in requests
+func testKinesis(requests *[]string) (*kinesis.Kinesis, *httptest.Server) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "Kinesis_20131202.")
+		*requests = append(*requests, target)
+
+		switch target {
+		case "PutRecords":
+			w.Write([]byte(`{"FailedRecordCount":0,"Records":[{"SequenceNumber":"1","ShardId":"shardId-000000000000"},{"SequenceNumber":"2","ShardId":"shardId-000000000000"}]}`))
+		case "PutRecord":
+			w.Write([]byte(`{"SequenceNumber":"3","ShardId":"shardId-000000000000"}`))
+		default:
+			http.Error(w, "unknown target", 400)
+		}
+	}))
+
+	Kinesis := kinesis.New(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		Endpoint:    aws.String(ts.URL),
+		MaxRetries:  aws.Int(0),
+		Region:      aws.String("us-east-1"),
+	})
+
+	return Kinesis, ts
+}
+
+func testLifecycleMonitor() *Monitor {
+	return &Monitor{
+		envs: map[string]map[string]string{
+			"8dfafdbc3a40": {"KINESIS": "myapp-Kinesis-L6MUKT1VH451", "KINESIS_ORDERED": "true"},
+			"977a93d4d48e": {"KINESIS": "myapp-Kinesis-L6MUKT1VH451", "PROCESS": "web"},
+		},
+		lines:   make(map[string][]*kinesis.PutRecordsRequestEntry),
+		ordered: make(map[string]*orderedQueue),
+		paused:  make(map[string]bool),
+		slo:     NewSLOTracker(),
+	}
+}
+
+func TestFlushLines(t *testing.T) {
+	requests := []string{}
+
+	Kinesis, ts := testKinesis(&requests)
+	defer ts.Close()
+
+	m := testLifecycleMonitor()
+
+	m.addContainerLine("977a93d4d48e", "myapp-Kinesis-L6MUKT1VH451", "one", []byte("one"))
+	m.addContainerLine("977a93d4d48e", "myapp-Kinesis-L6MUKT1VH451", "two", []byte("two"))
+	m.addContainerLine("8dfafdbc3a40", "myapp-Kinesis-L6MUKT1VH451", "ordered", []byte("ordered"))
+
+	m.flushLines(Kinesis)
+
+	assert.Equal(t, []string{"PutRecords", "PutRecord"}, requests)
+	assert.Nil(t, m.getLines("myapp-Kinesis-L6MUKT1VH451"))
+	assert.Equal(t, []string{}, m.orderedContainers())
+}
+
+func TestHandleLifecycleState(t *testing.T) {
+	requests := []string{}
+
+	Kinesis, ts := testKinesis(&requests)
+	defer ts.Close()
+
+	// the ECS agent doesn't know the instance yet, so draining is skipped
+	ecs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, "ecs metadata")
+		w.Write([]byte(`{"Cluster":null}`))
+	}))
+	defer ecs.Close()
+
+	endpoint := ECS_METADATA_ENDPOINT
+	defer func() { ECS_METADATA_ENDPOINT = endpoint }()
+
+	ECS_METADATA_ENDPOINT = ecs.URL
+
+	m := testLifecycleMonitor()
+
+	m.handleLifecycleState(Kinesis, "Warmed:Running")
+	assert.True(t, m.isWarm())
+
+	m.handleLifecycleState(Kinesis, "InService")
+	assert.False(t, m.isWarm())
+
+	m.logAppEvent("977a93d4d48e", "Starting web process 977a93d4d48e")
+	m.handleLifecycleState(Kinesis, "InService")
+	assert.Equal(t, []string{}, requests)
+
+	// lines are flushed before draining is attempted
+	m.handleLifecycleState(Kinesis, "Terminated")
+	assert.Equal(t, []string{"PutRecords", "ecs metadata"}, requests)
+	assert.Nil(t, m.getLines("myapp-Kinesis-L6MUKT1VH451"))
+}
+
+func TestWarmPoolEvents(t *testing.T) {
+	handler := awsutil.NewHandler([]awsutil.Cycle{
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/containers/977a93d4d48e/json",
+				Operation:  "",
+				Body:       ``,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"Id": "977a93d4d48e", "Config": {"Env": ["KINESIS=myapp-Kinesis-L6MUKT1VH451", "PROCESS=web"]}, "HostConfig": {"LogConfig": {"Type": "json-file"}}}`,
+			},
+		},
+	})
+
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	client, err := docker.NewClient(ts.URL)
+	assert.Nil(t, err)
+
+	m := testLifecycleMonitor()
+	m.client = client
+	m.envs = make(map[string]map[string]string)
+	m.logDrivers = make(map[string]string)
+	m.lifecycleState = "Warmed:Running"
+
+	// containers starting in a warm pool are not app events
+	m.handleCreate("977a93d4d48e")
+	assert.Nil(t, m.getLines("myapp-Kinesis-L6MUKT1VH451"))
+
+	// but failures are
+	m.handleOom("977a93d4d48e")
+
+	lines := m.getLines("myapp-Kinesis-L6MUKT1VH451")
+	assert.Len(t, lines, 1)
+	assert.Contains(t, string(lines[0].Data), "Stopped web process 977a93d4d48e due to OOM")
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+// retention periods CloudWatch Logs accepts
+// http://docs.aws.amazon.com/AmazonCloudWatchLogs/latest/APIReference/API_PutRetentionPolicy.html
+var LOG_GROUP_RETENTIONS = []int64{1, 3, 5, 7, 14, 30, 60, 90, 120, 150, 180, 365, 400, 545, 731, 1827, 3653}
+
+// Reconcile every CloudWatch Logs group the agent writes to with the
+// retention and tags declared in config, creating missing groups.
+// LOG_GROUP_RETENTION=30 LOG_GROUP_TAGS=team=platform,env=production
+func (m *Monitor) LogGroups() {
+	m.logSystemf("loggroups at=start")
+
+	var retention int64
+
+	if r := os.Getenv("LOG_GROUP_RETENTION"); r != "" {
+		days, err := parseRetention(r)
+		if err != nil {
+			m.logSystemf("loggroups LOG_GROUP_RETENTION=%q err=%q", r, err)
+			m.ReportError(err)
+			return
+		}
+
+		retention = days
+	}
+
+	tags := parseTags(os.Getenv("LOG_GROUP_TAGS"))
+
+	// stay off unless asked for, reconciling needs IAM permissions racks don't have by default
+	if retention == 0 && len(tags) == 0 {
+		m.logSystemf("loggroups at=end reason=unconfigured")
+		return
+	}
+
+	// tag every log group with the tenant so shared logging accounts can partition
+	for _, t := range m.tenantTags() {
+		tags[t.key] = t.value
+	}
+
+	CloudWatchLogs := cloudwatchlogs.New(&aws.Config{})
+
+	reconcile := func() {
+		for _, group := range m.logGroups() {
+			m.reconcileLogGroup(CloudWatchLogs, group, retention, tags)
+		}
+	}
+
+	// reconcile right away rather than waiting out the first interval
+	reconcile()
+
+	for _ = range time.Tick(MONITOR_INTERVAL) {
+		reconcile()
+	}
+}
+
+func (m *Monitor) reconcileLogGroup(CloudWatchLogs *cloudwatchlogs.CloudWatchLogs, group string, retention int64, tags map[string]string) {
+	res, err := CloudWatchLogs.DescribeLogGroups(&cloudwatchlogs.DescribeLogGroupsInput{
+		LogGroupNamePrefix: aws.String(group),
+	})
+	if err != nil {
+		m.logSystemf("loggroups DescribeLogGroups group=%s count#LogGroupReconcileError=1 err=%q", group, err)
+		return
+	}
+
+	var lg *cloudwatchlogs.LogGroup
+
+	for _, g := range res.LogGroups {
+		if *g.LogGroupName == group {
+			lg = g
+		}
+	}
+
+	if lg == nil {
+		_, err := CloudWatchLogs.CreateLogGroup(&cloudwatchlogs.CreateLogGroupInput{
+			LogGroupName: aws.String(group),
+		})
+		if err != nil {
+			m.logSystemf("loggroups CreateLogGroup group=%s count#LogGroupReconcileError=1 err=%q", group, err)
+			return
+		}
+
+		m.logSystemf("loggroups CreateLogGroup group=%s count#LogGroupCreated=1", group)
+
+		lg = &cloudwatchlogs.LogGroup{LogGroupName: aws.String(group)}
+	}
+
+	if retentionChanged(lg, retention) {
+		_, err := CloudWatchLogs.PutRetentionPolicy(&cloudwatchlogs.PutRetentionPolicyInput{
+			LogGroupName:    aws.String(group),
+			RetentionInDays: aws.Int64(retention),
+		})
+		if err != nil {
+			m.logSystemf("loggroups PutRetentionPolicy group=%s retention=%d count#LogGroupReconcileError=1 err=%q", group, retention, err)
+		} else {
+			m.logSystemf("loggroups PutRetentionPolicy group=%s retention=%d count#LogGroupRetentionUpdated=1", group, retention)
+		}
+	}
+
+	if len(tags) > 0 {
+		m.reconcileLogGroupTags(group, tags)
+	}
+}
+
+// The vendored SDK predates log group tagging, so this needs the aws cli installed in the image
+func (m *Monitor) reconcileLogGroupTags(group string, tags map[string]string) {
+	out, err := exec.Command("aws", "logs", "list-tags-log-group", "--region", m.region, "--log-group-name", group, "--output", "json").Output()
+	if err != nil {
+		m.logSystemf("loggroups list-tags-log-group group=%s count#LogGroupReconcileError=1 err=%q", group, err)
+		return
+	}
+
+	var current struct {
+		Tags map[string]string `json:"tags"`
+	}
+
+	if err := json.Unmarshal(out, &current); err != nil {
+		m.logSystemf("loggroups list-tags-log-group group=%s count#LogGroupReconcileError=1 err=%q", group, err)
+		return
+	}
+
+	missing := missingTags(current.Tags, tags)
+
+	if len(missing) == 0 {
+		return
+	}
+
+	err = exec.Command("aws", "logs", "tag-log-group", "--region", m.region, "--log-group-name", group, "--tags", strings.Join(missing, ",")).Run()
+	if err != nil {
+		m.logSystemf("loggroups tag-log-group group=%s tags=%q count#LogGroupReconcileError=1 err=%q", group, strings.Join(missing, ","), err)
+	} else {
+		m.logSystemf("loggroups tag-log-group group=%s tags=%q count#LogGroupTagsUpdated=1", group, strings.Join(missing, ","))
+	}
+}
+
+// parseRetention parses a retention period in days, which must be one CloudWatch Logs accepts
+func parseRetention(s string) (int64, error) {
+	days, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, r := range LOG_GROUP_RETENTIONS {
+		if days == r {
+			return days, nil
+		}
+	}
+
+	return 0, fmt.Errorf("retention must be one of %v days", LOG_GROUP_RETENTIONS)
+}
+
+// retentionChanged reports if a log group needs its retention policy set
+func retentionChanged(lg *cloudwatchlogs.LogGroup, retention int64) bool {
+	if retention == 0 {
+		return false
+	}
+
+	return lg.RetentionInDays == nil || *lg.RetentionInDays != retention
+}
+
+// missingTags returns the desired tags that are absent or different, as sorted key=value pairs
+func missingTags(current, desired map[string]string) []string {
+	missing := []string{}
+
+	for k, v := range desired {
+		if cv, ok := current[k]; !ok || cv != v {
+			missing = append(missing, fmt.Sprintf("%s=%s", k, v))
+		}
+	}
+
+	sort.Strings(missing)
+
+	return missing
+}
+
+// parseTags parses a list like "team=platform,env=production"
+func parseTags(s string) map[string]string {
+	tags := map[string]string{}
+
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+
+		if len(parts) == 2 && parts[0] != "" {
+			tags[parts[0]] = parts[1]
+		}
+	}
+
+	return tags
+}
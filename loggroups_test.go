@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTags(t *testing.T) {
+	assert.Equal(t, map[string]string{}, parseTags(""))
+	assert.Equal(t, map[string]string{"team": "platform", "env": "production"}, parseTags("team=platform, env=production"))
+	assert.Equal(t, map[string]string{"url": "a=b"}, parseTags("url=a=b,novalue,=empty"))
+}
+
+func TestParseRetention(t *testing.T) {
+	days, err := parseRetention("30")
+	assert.Nil(t, err)
+	assert.EqualValues(t, 30, days)
+
+	for _, r := range []string{"45", "-1", "0", "forever"} {
+		_, err := parseRetention(r)
+		assert.NotNil(t, err, r)
+	}
+}
+
+func TestRetentionChanged(t *testing.T) {
+	assert.False(t, retentionChanged(&cloudwatchlogs.LogGroup{}, 0))
+	assert.True(t, retentionChanged(&cloudwatchlogs.LogGroup{}, 30))
+	assert.True(t, retentionChanged(&cloudwatchlogs.LogGroup{RetentionInDays: aws.Int64(7)}, 30))
+	assert.False(t, retentionChanged(&cloudwatchlogs.LogGroup{RetentionInDays: aws.Int64(30)}, 30))
+}
+
+func TestMissingTags(t *testing.T) {
+	desired := map[string]string{"team": "platform", "env": "production"}
+
+	assert.Equal(t, []string{"env=production", "team=platform"}, missingTags(nil, desired))
+	assert.Equal(t, []string{"env=production"}, missingTags(map[string]string{"team": "platform", "env": "staging"}, desired))
+	assert.Equal(t, []string{}, missingTags(map[string]string{"team": "platform", "env": "production", "extra": "x"}, desired))
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// syslog priority Heroku uses for app output: facility local7 (23), severity info (6)
+var LOGPLEX_PRIORITY = 190
+
+// formatLogplex frames a line the way Heroku logplex delivers it to drains:
+// an RFC5424 syslog message with an octet-counting length prefix
+// 75 <190>1 2016-05-16T21:01:54.123456+00:00 host app web.1 - Hello from Docker.
+func formatLogplex(ts time.Time, appName, procId, line string) string {
+	msg := fmt.Sprintf("<%d>1 %s host %s %s - %s", LOGPLEX_PRIORITY, ts.UTC().Format("2006-01-02T15:04:05.000000+00:00"), appName, procId, line)
+
+	return fmt.Sprintf("%d %s", len(msg), msg)
+}
+
+// logplexDyno returns a Heroku-style dyno name for a process type
+// web -> web.1
+func logplexDyno(process string) string {
+	if process == "" {
+		process = "run"
+	}
+
+	return fmt.Sprintf("%s.1", process)
+}
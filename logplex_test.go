@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatLogplex(t *testing.T) {
+	ts := time.Date(2016, 5, 16, 21, 1, 54, 123456000, time.UTC)
+
+	assert.Equal(t,
+		"75 <190>1 2016-05-16T21:01:54.123456+00:00 host app web.1 - Hello from Docker.",
+		formatLogplex(ts, "app", logplexDyno("web"), "Hello from Docker."),
+	)
+}
+
+func TestLogplexDyno(t *testing.T) {
+	assert.Equal(t, "worker.1", logplexDyno("worker"))
+	assert.Equal(t, "run.1", logplexDyno(""))
+}
+
+func TestLogAppEventLogplex(t *testing.T) {
+	m := &Monitor{
+		envs: map[string]map[string]string{
+			"977a93d4d48e": {"KINESIS": "myapp-Kinesis-L6MUKT1VH451", "LOG_FORMAT": "logplex", "PROCESS": "web"},
+		},
+		lines: make(map[string][]*kinesis.PutRecordsRequestEntry),
+	}
+
+	m.logAppEvent("977a93d4d48e", "Starting web process 977a93d4d48e")
+
+	lines := m.getLines("myapp-Kinesis-L6MUKT1VH451")
+	assert.Len(t, lines, 1)
+	assert.Regexp(t, `^93 <190>1 \S+ host heroku web\.1 - Starting web process 977a93d4d48e$`, string(lines[0].Data))
+}
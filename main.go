@@ -7,10 +7,14 @@ var MONITOR_INTERVAL = 5 * time.Minute
 func main() {
 	monitor := NewMonitor()
 
+	go monitor.Admin()
 	go monitor.Containers()
 	go monitor.Disk()
 	go monitor.Docker()
 	go monitor.Dmesg()
+	go monitor.Lifecycle()
+	go monitor.LogGroups()
+	go monitor.SLO()
 	go monitor.Spot()
 
 	for {
@@ -5,13 +5,16 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/Sirupsen/logrus"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/ec2metadata"
 	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/kinesis"
 	"github.com/stvp/rollbar"
 
 	"github.com/docker/docker/daemon/logger"
@@ -23,17 +26,27 @@ type Monitor struct {
 
 	envs       map[string]map[string]string
 	logDrivers map[string]string
+	scrubbers  map[string][]scrubber
 
 	agentId      string
 	agentImage   string
 	agentVersion string
 
+	clientId     string
+	environment  string
+	instanceTags []tag
+	tenantPrefix bool
+
+	partitionKeys map[string]string
+
 	amiId        string
 	az           string
 	instanceId   string
 	instanceType string
 	region       string
 
+	lifecycleState string
+
 	dockerDriver        string
 	dockerServerVersion string
 	ecsAgentImage       string
@@ -41,12 +54,22 @@ type Monitor struct {
 	convoxVersion       string
 
 	lock    sync.Mutex
-	lines   map[string][][]byte
+	lines   map[string][]*kinesis.PutRecordsRequestEntry
 	loggers map[string]logger.Logger
+
+	ordered map[string]*orderedQueue
+
+	filters map[string]*regexp.Regexp
+	samples map[string]float64
+	paused  map[string]bool
+	held    map[string][]heldMessage
+	dropped map[string]int
+
+	slo *SLOTracker
 }
 
 func NewMonitor() *Monitor {
-	fmt.Printf("NewMonitor at=start client_id=%s region=%s kinesis=%s log_group=%s\n", os.Getenv("CLIENT_ID"), os.Getenv("AWS_REGION"), os.Getenv("KINESIS"), os.Getenv("LOG_GROUP"))
+	fmt.Printf("NewMonitor at=start client_id=%s environment=%s region=%s kinesis=%s log_group=%s\n", os.Getenv("CLIENT_ID"), os.Getenv("ENVIRONMENT"), os.Getenv("AWS_REGION"), os.Getenv("KINESIS"), os.Getenv("LOG_GROUP"))
 
 	client, err := docker.NewClient(os.Getenv("DOCKER_HOST"))
 	if err != nil {
@@ -68,11 +91,16 @@ func NewMonitor() *Monitor {
 
 		envs:       make(map[string]map[string]string),
 		logDrivers: make(map[string]string),
+		scrubbers:  make(map[string][]scrubber),
 
 		agentId:      "unknown",          // updated during handleRunning
 		agentImage:   "convox/agent:dev", // updated during handleRunning
 		agentVersion: "dev",              // updated during handleRunning
 
+		clientId:     os.Getenv("CLIENT_ID"),
+		environment:  os.Getenv("ENVIRONMENT"),
+		tenantPrefix: os.Getenv("TENANT_PREFIX") == "true",
+
 		amiId:        "ami-dev",
 		az:           "us-dev-1b",
 		instanceId:   "i-dev",
@@ -84,10 +112,29 @@ func NewMonitor() *Monitor {
 		ecsAgentImage:       img,
 		kernelVersion:       info.Get("KernelVersion"),
 
-		lines:   make(map[string][][]byte),
+		lines:   make(map[string][]*kinesis.PutRecordsRequestEntry),
 		loggers: make(map[string]logger.Logger),
+
+		ordered: make(map[string]*orderedQueue),
+
+		filters: make(map[string]*regexp.Regexp),
+		samples: make(map[string]float64),
+		paused:  make(map[string]bool),
+		held:    make(map[string][]heldMessage),
+		dropped: make(map[string]int),
+
+		slo: NewSLOTracker(),
 	}
 
+	// KINESIS_PARTITION_KEYS=myapp-Kinesis-L6MUKT1VH451=process,other-Kinesis-1TNNP6B9GVOSL=random
+	partitionKeys, invalid := parsePartitionKeys(os.Getenv("KINESIS_PARTITION_KEYS"))
+
+	for stream, strategy := range invalid {
+		fmt.Printf("NewMonitor KINESIS_PARTITION_KEYS stream=%s strategy=%q err=\"strategy must be one of %v, using timestamp\"\n", stream, strategy, PARTITION_KEY_STRATEGIES)
+	}
+
+	m.partitionKeys = partitionKeys
+
 	cfg := ec2metadata.Config{}
 
 	if os.Getenv("EC2_METADATA_ENDPOINT") != "" {
@@ -102,10 +149,19 @@ func NewMonitor() *Monitor {
 		m.instanceId, _ = svc.GetMetadata("instance-id")
 		m.instanceType, _ = svc.GetMetadata("instance-type")
 		m.region, _ = svc.Region()
+		m.lifecycleState, _ = svc.GetMetadata("autoscaling/target-lifecycle-state")
+
+		// INSTANCE_TAGS=Cluster,Environment,Team
+		if names := os.Getenv("INSTANCE_TAGS"); names != "" {
+			m.instanceTags, err = m.describeInstanceTags(strings.Split(names, ","))
+			if err != nil {
+				fmt.Printf("NewMonitor describeInstanceTags names=%s err=%q\n", names, err)
+			}
+		}
 	}
 
-	fmt.Printf("NewMonitor az=%s instanceId=%s instanceType=%s region=%s agentImage=%s amiId=%s dockerServerVersion=%s ecsAgentImage=%s kernelVersion=%s\n",
-		m.az, m.instanceId, m.instanceType, m.region,
+	fmt.Printf("NewMonitor az=%s instanceId=%s instanceType=%s region=%s lifecycleState=%s agentImage=%s amiId=%s dockerServerVersion=%s ecsAgentImage=%s kernelVersion=%s\n",
+		m.az, m.instanceId, m.instanceType, m.region, m.lifecycleState,
 		m.agentImage, m.amiId, m.dockerServerVersion, m.ecsAgentImage, m.kernelVersion,
 	)
 
@@ -117,26 +173,62 @@ func (m *Monitor) logAppEvent(id, message string) {
 	// append syslog-ish prefix:
 	// agent:0.66/i-553ffcd2 Starting hello-world process 977a93d4d48e
 
+	event := message
+
+	message = m.tagPrefix() + message
+
 	msg := fmt.Sprintf("agent:%s/%s %s", m.agentVersion, m.instanceId, message)
 
 	ts := time.Now()
 
-	if awslogger, ok := m.loggers[id]; ok {
-		awslogger.Log(&logger.Message{
-			ContainerID: id,
-			Line:        []byte(msg),
-			Timestamp:   ts,
-		})
+	kmsg := fmt.Sprintf("%s %s", ts.Format("2006-01-02 15:04:05"), msg) // add timestamp to kinesis for legacy purposes
+
+	env, _ := m.getEnv(id)
+
+	// or frame like Heroku platform events:
+	// 93 <190>1 2016-05-16T21:01:54.123456+00:00 host heroku web.1 - Starting web process 977a93d4d48e
+	if env["LOG_FORMAT"] == "logplex" {
+		msg = formatLogplex(ts, "heroku", logplexDyno(env["PROCESS"]), message)
+		kmsg = msg
 	}
 
-	if stream, ok := m.envs[id]["KINESIS"]; ok {
-		m.addLine(stream, []byte(fmt.Sprintf("%s %s", ts.Format("2006-01-02 15:04:05"), msg))) // add timestamp to kinesis for legacy purposes
+	m.logContainerMessage(id, env["LOG_GROUP"], &logger.Message{
+		ContainerID: id,
+		Line:        []byte(msg),
+		Timestamp:   ts,
+	})
+
+	if stream, ok := env["KINESIS"]; ok {
+		m.addContainerLine(id, stream, event, []byte(kmsg))
 	}
 }
 
 // logSystem write event to stdout and convox CloudWatch Log Group, prefixed with an instance id
 func (m *Monitor) logSystemf(format string, a ...interface{}) {
+	m.logLevelf(logrus.InfoLevel, format, a...)
+}
+
+// logDebugf writes verbose events only when the admin API sets level=debug
+func (m *Monitor) logDebugf(format string, a ...interface{}) {
+	m.logLevelf(logrus.DebugLevel, format, a...)
+}
+
+// logLevelf writes an event if the log level allows it
+// Metrics are always written so dashboards and alarms don't go quiet at level=warn
+func (m *Monitor) logLevelf(level logrus.Level, format string, a ...interface{}) {
 	line := fmt.Sprintf(format, a...)
+
+	metric := strings.Contains(line, "count#") || strings.Contains(line, "sample#")
+
+	if level > logrus.GetLevel() && !metric {
+		return
+	}
+
+	// partition metrics by tenant
+	if dims := m.tagDimensions(); dims != "" && metric {
+		line = fmt.Sprintf("%s %s", line, dims)
+	}
+
 	l := fmt.Sprintf("agent:%s/%s %s", m.agentVersion, m.instanceId, line)
 
 	fmt.Println(l)
@@ -183,7 +275,8 @@ func (m *Monitor) ReportError(err error) {
 		"agentId":    m.agentId,
 		"agentImage": m.agentImage,
 
-		"clientId": os.Getenv("CLIENT_ID"),
+		"clientId":    m.clientId,
+		"environment": m.environment,
 
 		"amiId":        m.amiId,
 		"az":           m.az,
@@ -196,6 +289,11 @@ func (m *Monitor) ReportError(err error) {
 		"ecsAgentImage":       m.ecsAgentImage,
 		"kernelVersion":       m.kernelVersion,
 	}
+
+	for _, t := range m.instanceTags {
+		extraData[t.key] = t.value
+	}
+
 	extraField := &rollbar.Field{"env", extraData}
 
 	rollbar.ErrorWithStackSkip(rollbar.CRIT, err, 1, extraField)
@@ -3,8 +3,10 @@ package main
 import (
 	"net/http/httptest"
 	"os"
+	"regexp"
 	"testing"
 
+	"github.com/aws/aws-sdk-go/service/kinesis"
 	"github.com/convox/rack/api/awsutil"
 	"github.com/docker/docker/daemon/logger"
 	"github.com/stretchr/testify/assert"
@@ -111,6 +113,17 @@ func TestNewMonitor(t *testing.T) {
 				Body:       `us-east-1c`,
 			},
 		},
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/meta-data/autoscaling/target-lifecycle-state",
+				Operation:  "",
+				Body:       ``,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `InService`,
+			},
+		},
 	})
 	s := httptest.NewServer(handler)
 
@@ -123,25 +136,40 @@ func TestNewMonitor(t *testing.T) {
 		&Monitor{
 			client: monitor.client,
 
-			envs: make(map[string]map[string]string),
+			envs:      make(map[string]map[string]string),
+			scrubbers: make(map[string][]scrubber),
 
 			agentId:      "unknown",
 			agentImage:   "convox/agent:dev",
 			agentVersion: "dev",
 
+			partitionKeys: map[string]string{},
+
 			amiId:        "ami-cb2305a1",
 			az:           "us-east-1c",
 			instanceId:   "i-05c7e6b6fcc83ae8a",
 			instanceType: "r3.large",
 			region:       "us-east-1",
 
+			lifecycleState: "InService",
+
 			dockerDriver:        "devicemapper",
 			dockerServerVersion: "1.9.1",
 			ecsAgentImage:       "46e05d110968",
 			kernelVersion:       "4.1.13-19.31.amzn1.x86_64",
 
-			lines:   make(map[string][][]byte),
+			lines:   make(map[string][]*kinesis.PutRecordsRequestEntry),
 			loggers: make(map[string]logger.Logger),
+
+			ordered: make(map[string]*orderedQueue),
+
+			filters: make(map[string]*regexp.Regexp),
+			samples: make(map[string]float64),
+			paused:  make(map[string]bool),
+			held:    make(map[string][]heldMessage),
+			dropped: make(map[string]int),
+
+			slo: NewSLOTracker(),
 		},
 		monitor,
 	)
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+// lines held per ordered container before new lines are dropped
+var ORDERED_LINES_MAX = 10000
+
+// how long a dead container's queue is kept after its last line is sent, so events
+// and log lines that arrive after the die event keep the same sequence chain
+var ORDERED_EXITED_TTL = 10 * time.Minute
+
+// PutRecord errors that will never succeed on retry, the record is dropped so it doesn't block the lines behind it
+var ORDERED_PERMANENT_ERRORS = map[string]bool{
+	"InvalidArgumentException":  true,
+	"InvalidParameter":          true,
+	"ResourceNotFoundException": true,
+	"ValidationException":       true,
+}
+
+// orderedQueue holds lines for a KINESIS_ORDERED container
+// Fields other than send are guarded by the Monitor lock
+type orderedQueue struct {
+	send sync.Mutex // only one sender at a time or lines could be put twice or out of order
+
+	lines    [][]byte
+	sequence string
+	dropped  int
+	sending  bool
+	exited   time.Time
+}
+
+// Containers with KINESIS_ORDERED=true send lines one at a time with PutRecord,
+// partitioned by container id and chained with SequenceNumberForOrdering
+// This trades throughput for strict per-container ordering in Kinesis
+func (m *Monitor) streamOrderedLogs() {
+	Kinesis := kinesis.New(&aws.Config{})
+
+	for _ = range time.Tick(100 * time.Millisecond) {
+		for _, id := range m.orderedContainers() {
+			// a sender per container so one busy or failing container can't hold up the rest
+			if m.startOrderedSender(id) {
+				go func(id string) {
+					defer m.stopOrderedSender(id)
+					m.putOrderedLines(Kinesis, id)
+				}(id)
+			}
+		}
+	}
+}
+
+// putOrderedLines sends queued lines for a container in order
+// On a retryable error it stops and leaves the line queued so a later attempt can't put it out of order
+func (m *Monitor) putOrderedLines(Kinesis *kinesis.Kinesis, id string) {
+	q, ok := m.getOrderedQueue(id)
+	if !ok {
+		return
+	}
+
+	env, _ := m.getEnv(id)
+	stream := env["KINESIS"]
+
+	// hold lines for streams paused via the admin API
+	if stream == "" || m.isPaused(stream) {
+		return
+	}
+
+	q.send.Lock()
+	defer q.send.Unlock()
+
+	if n := m.takeOrderedDropped(id); n > 0 {
+		m.logSystemf("container streamOrderedLogs id=%s stream=%s count#KinesisOrderedLinesDropped=%d", id, stream, n)
+	}
+
+	for {
+		line, ok := m.peekOrderedLine(id)
+		if !ok {
+			return
+		}
+
+		input := &kinesis.PutRecordInput{
+			Data:         line,
+			PartitionKey: aws.String(id),
+			StreamName:   aws.String(stream),
+		}
+
+		if seq, ok := m.getSequence(id); ok {
+			input.SequenceNumberForOrdering = aws.String(seq)
+		}
+
+		res, err := Kinesis.PutRecord(input)
+		if err != nil {
+			m.slo.Record("kinesis:"+stream, 0, 1, time.Now())
+
+			if retryablePutRecordError(err) {
+				m.logSystemf("container streamOrderedLogs id=%s stream=%s count#KinesisPutRecordError=1 err=%q", id, stream, err)
+				return
+			}
+
+			m.logSystemf("container streamOrderedLogs id=%s stream=%s count#KinesisOrderedLinesDropped=1 err=%q", id, stream, err)
+			m.popOrderedLine(id)
+			continue
+		}
+
+		m.slo.Record("kinesis:"+stream, 1, 0, time.Now())
+
+		m.setSequence(id, *res.SequenceNumber)
+		m.popOrderedLine(id)
+	}
+}
+
+// retryablePutRecordError reports if a failed PutRecord may succeed later,
+// like throttling, service and network errors
+func retryablePutRecordError(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		return !ORDERED_PERMANENT_ERRORS[aerr.Code()]
+	}
+
+	return true
+}
+
+// addContainerLine queues a Kinesis record for a container's stream, ordered if the container asks for it
+// line is the app's line before any prefix or framing, which the hash partition key uses
+func (m *Monitor) addContainerLine(id, stream, line string, data []byte) {
+	env, _ := m.getEnv(id)
+
+	if env["KINESIS_ORDERED"] == "true" {
+		m.addOrderedLine(id, data)
+		return
+	}
+
+	m.addLine(stream, data, partitionKey(m.partitionKeys[stream], appName(env), env["PROCESS"], id, line))
+}
+
+func (m *Monitor) addOrderedLine(id string, data []byte) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	q, ok := m.ordered[id]
+	if !ok {
+		q = &orderedQueue{}
+		m.ordered[id] = q
+	}
+
+	if len(q.lines) >= ORDERED_LINES_MAX {
+		q.dropped += 1
+		return
+	}
+
+	q.lines = append(q.lines, data)
+}
+
+func (m *Monitor) getOrderedQueue(id string) (*orderedQueue, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	q, ok := m.ordered[id]
+	return q, ok
+}
+
+func (m *Monitor) peekOrderedLine(id string) ([]byte, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	q, ok := m.ordered[id]
+	if !ok || len(q.lines) == 0 {
+		return nil, false
+	}
+
+	return q.lines[0], true
+}
+
+func (m *Monitor) popOrderedLine(id string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if q, ok := m.ordered[id]; ok && len(q.lines) > 0 {
+		q.lines = q.lines[1:]
+	}
+}
+
+// orderedContainers returns containers with lines to send, removing queues for containers that exited a while ago
+func (m *Monitor) orderedContainers() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	ids := []string{}
+
+	for id, q := range m.ordered {
+		if len(q.lines) > 0 {
+			ids = append(ids, id)
+			continue
+		}
+
+		if !q.exited.IsZero() && !q.sending && time.Since(q.exited) >= ORDERED_EXITED_TTL {
+			delete(m.ordered, id)
+		}
+	}
+
+	return ids
+}
+
+// startOrderedSender claims a container for a sender goroutine, returning false if one is already running
+func (m *Monitor) startOrderedSender(id string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	q, ok := m.ordered[id]
+	if !ok || q.sending {
+		return false
+	}
+
+	q.sending = true
+	return true
+}
+
+func (m *Monitor) stopOrderedSender(id string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if q, ok := m.ordered[id]; ok {
+		q.sending = false
+	}
+}
+
+// exitOrderedQueue marks a dead container's queue for removal once its lines are sent and ORDERED_EXITED_TTL passes
+// It is called on the die event and again when its logs stop, creating the queue if needed so a late line
+// can't start a fresh queue that is never removed
+func (m *Monitor) exitOrderedQueue(id string) {
+	env, _ := m.getEnv(id)
+
+	if env["KINESIS_ORDERED"] != "true" {
+		return
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	q, ok := m.ordered[id]
+	if !ok {
+		q = &orderedQueue{}
+		m.ordered[id] = q
+	}
+
+	q.exited = time.Now()
+}
+
+func (m *Monitor) takeOrderedDropped(id string) int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	q, ok := m.ordered[id]
+	if !ok {
+		return 0
+	}
+
+	n := q.dropped
+	q.dropped = 0
+	return n
+}
+
+func (m *Monitor) getSequence(id string) (string, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	q, ok := m.ordered[id]
+	if !ok || q.sequence == "" {
+		return "", false
+	}
+
+	return q.sequence, true
+}
+
+func (m *Monitor) setSequence(id, seq string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if q, ok := m.ordered[id]; ok {
+		q.sequence = seq
+	}
+}
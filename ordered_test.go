@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddContainerLine(t *testing.T) {
+	m := &Monitor{
+		envs: map[string]map[string]string{
+			"8dfafdbc3a40": {"KINESIS": "myapp-Kinesis-L6MUKT1VH451", "KINESIS_ORDERED": "true"},
+			"977a93d4d48e": {"KINESIS": "myapp-Kinesis-L6MUKT1VH451"},
+		},
+		lines:   make(map[string][]*kinesis.PutRecordsRequestEntry),
+		ordered: make(map[string]*orderedQueue),
+	}
+
+	m.addContainerLine("8dfafdbc3a40", "myapp-Kinesis-L6MUKT1VH451", "first", []byte("first"))
+	m.addContainerLine("8dfafdbc3a40", "myapp-Kinesis-L6MUKT1VH451", "second", []byte("second"))
+	m.addContainerLine("977a93d4d48e", "myapp-Kinesis-L6MUKT1VH451", "unordered", []byte("unordered"))
+
+	lines := m.getLines("myapp-Kinesis-L6MUKT1VH451")
+	assert.Len(t, lines, 1)
+	assert.Equal(t, "unordered", string(lines[0].Data))
+	assert.Equal(t, []string{"8dfafdbc3a40"}, m.orderedContainers())
+
+	line, ok := m.peekOrderedLine("8dfafdbc3a40")
+	assert.True(t, ok)
+	assert.Equal(t, "first", string(line))
+
+	m.popOrderedLine("8dfafdbc3a40")
+
+	line, ok = m.peekOrderedLine("8dfafdbc3a40")
+	assert.True(t, ok)
+	assert.Equal(t, "second", string(line))
+
+	m.popOrderedLine("8dfafdbc3a40")
+
+	_, ok = m.peekOrderedLine("8dfafdbc3a40")
+	assert.False(t, ok)
+	assert.Equal(t, []string{}, m.orderedContainers())
+}
+
+func TestPutOrderedLines(t *testing.T) {
+	max := ORDERED_LINES_MAX
+	defer func() { ORDERED_LINES_MAX = max }()
+
+	ORDERED_LINES_MAX = 3
+
+	// PutRecord responses in order, a record over 1MB, throttling then success
+	responses := []struct {
+		code int
+		body string
+	}{
+		{400, `{"__type":"ValidationException","message":"record size exceeds 1MB"}`},
+		{400, `{"__type":"ProvisionedThroughputExceededException","message":"rate exceeded"}`},
+		{200, `{"SequenceNumber":"1","ShardId":"shardId-000000000000"}`},
+		{200, `{"SequenceNumber":"2","ShardId":"shardId-000000000000"}`},
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res := responses[0]
+		responses = responses[1:]
+
+		w.WriteHeader(res.code)
+		w.Write([]byte(res.body))
+	}))
+	defer ts.Close()
+
+	Kinesis := kinesis.New(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		Endpoint:    aws.String(ts.URL),
+		MaxRetries:  aws.Int(0),
+		Region:      aws.String("us-east-1"),
+	})
+
+	m := &Monitor{
+		envs: map[string]map[string]string{
+			"8dfafdbc3a40": {"KINESIS": "myapp-Kinesis-L6MUKT1VH451", "KINESIS_ORDERED": "true"},
+		},
+		ordered: make(map[string]*orderedQueue),
+		paused:  make(map[string]bool),
+		slo:     NewSLOTracker(),
+	}
+
+	for _, line := range []string{"huge", "first", "second", "over cap"} {
+		m.addOrderedLine("8dfafdbc3a40", []byte(line))
+	}
+
+	assert.Equal(t, 1, m.ordered["8dfafdbc3a40"].dropped)
+
+	// the poison record is dropped, throttling leaves the next line queued
+	m.putOrderedLines(Kinesis, "8dfafdbc3a40")
+
+	line, ok := m.peekOrderedLine("8dfafdbc3a40")
+	assert.True(t, ok)
+	assert.Equal(t, "first", string(line))
+	assert.Equal(t, 0, m.ordered["8dfafdbc3a40"].dropped)
+
+	m.putOrderedLines(Kinesis, "8dfafdbc3a40")
+
+	_, ok = m.peekOrderedLine("8dfafdbc3a40")
+	assert.False(t, ok)
+
+	seq, _ := m.getSequence("8dfafdbc3a40")
+	assert.Equal(t, "2", seq)
+
+	// a line after the die event joins the same queue and sequence chain
+	m.exitOrderedQueue("8dfafdbc3a40")
+	m.addOrderedLine("8dfafdbc3a40", []byte("Stopped process 8dfafdbc3a40 via SIGTERM"))
+	assert.Equal(t, []string{"8dfafdbc3a40"}, m.orderedContainers())
+
+	seq, _ = m.getSequence("8dfafdbc3a40")
+	assert.Equal(t, "2", seq)
+
+	m.popOrderedLine("8dfafdbc3a40")
+
+	// the queue is kept for a while after the container exits, then removed
+	assert.Equal(t, []string{}, m.orderedContainers())
+	_, ok = m.getOrderedQueue("8dfafdbc3a40")
+	assert.True(t, ok)
+
+	ttl := ORDERED_EXITED_TTL
+	defer func() { ORDERED_EXITED_TTL = ttl }()
+
+	ORDERED_EXITED_TTL = 0
+
+	assert.Equal(t, []string{}, m.orderedContainers())
+	_, ok = m.getOrderedQueue("8dfafdbc3a40")
+	assert.False(t, ok)
+	assert.Len(t, responses, 0)
+}
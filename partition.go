@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/md5"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var PARTITION_KEY_STRATEGIES = []string{"random", "container", "process", "hash", "timestamp"}
+
+// partitionKey picks a Kinesis partition key for a line using the stream's
+// KINESIS_PARTITION_KEYS strategy, balancing shard distribution against ordering
+//
+// random:    spread evenly across shards
+// container: keep each container's lines on one shard
+// process:   keep each app process type's lines on one shard
+// hash:      identical app lines land on the same shard, whatever container or time they came from
+// timestamp: the legacy default
+func partitionKey(strategy, app, process, id, line string) string {
+	switch strategy {
+	case "random":
+		return strconv.FormatInt(rand.Int63(), 16)
+	case "container":
+		return id
+	case "process":
+		return fmt.Sprintf("%s-%s", app, process)
+	case "hash":
+		return fmt.Sprintf("%x", md5.Sum([]byte(line)))
+	default:
+		return strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+}
+
+// parsePartitionKeys parses per-stream strategies like "myapp-Kinesis-L6MUKT1VH451=process,other-Kinesis-1TNNP6B9GVOSL=random"
+// Entries with an unknown strategy are returned separately so they can be logged
+func parsePartitionKeys(s string) (map[string]string, map[string]string) {
+	valid := map[string]string{}
+	invalid := map[string]string{}
+
+	for stream, strategy := range parseTags(s) {
+		strategy = strings.TrimSpace(strategy)
+
+		invalid[stream] = strategy
+
+		for _, st := range PARTITION_KEY_STRATEGIES {
+			if strategy == st {
+				valid[stream] = strategy
+				delete(invalid, stream)
+			}
+		}
+	}
+
+	return valid, invalid
+}
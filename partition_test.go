@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartitionKey(t *testing.T) {
+	data := "Hello from Docker."
+
+	assert.Equal(t, "8dfafdbc3a40", partitionKey("container", "myapp", "web", "8dfafdbc3a40", data))
+	assert.Equal(t, "myapp-web", partitionKey("process", "myapp", "web", "8dfafdbc3a40", data))
+
+	assert.Equal(t, partitionKey("hash", "myapp", "web", "8dfafdbc3a40", data), partitionKey("hash", "myapp", "web", "977a93d4d48e", data))
+	assert.Len(t, partitionKey("hash", "myapp", "web", "8dfafdbc3a40", data), 32)
+
+	assert.NotEmpty(t, partitionKey("random", "myapp", "web", "8dfafdbc3a40", data))
+
+	assert.Regexp(t, `^\d+$`, partitionKey("", "myapp", "web", "8dfafdbc3a40", data))
+}
+
+func TestParsePartitionKeys(t *testing.T) {
+	valid, invalid := parsePartitionKeys("myapp-Kinesis-L6MUKT1VH451=process, other-Kinesis-1TNNP6B9GVOSL=sharded,")
+
+	assert.Equal(t, map[string]string{"myapp-Kinesis-L6MUKT1VH451": "process"}, valid)
+	assert.Equal(t, map[string]string{"other-Kinesis-1TNNP6B9GVOSL": "sharded"}, invalid)
+}
+
+func TestAddContainerLinePartitionKey(t *testing.T) {
+	m := &Monitor{
+		envs: map[string]map[string]string{
+			// legacy containers without APP infer it from the stream name
+			"977a93d4d48e": {"KINESIS": "myapp-Kinesis-L6MUKT1VH451", "PROCESS": "web"},
+		},
+		lines:         make(map[string][]*kinesis.PutRecordsRequestEntry),
+		partitionKeys: map[string]string{"myapp-Kinesis-L6MUKT1VH451": "process"},
+	}
+
+	m.addContainerLine("977a93d4d48e", "myapp-Kinesis-L6MUKT1VH451", "Hello from Docker.", []byte("Hello from Docker."))
+
+	lines := m.getLines("myapp-Kinesis-L6MUKT1VH451")
+	assert.Len(t, lines, 1)
+	assert.Equal(t, "myapp-web", *lines[0].PartitionKey)
+}
+
+func TestParseAndForwardLineHashKey(t *testing.T) {
+	m := &Monitor{
+		envs: map[string]map[string]string{
+			"8dfafdbc3a40": {"KINESIS": "myapp-Kinesis-L6MUKT1VH451", "PROCESS": "web", "RELEASE": "RXZMCQEPDKO"},
+			"977a93d4d48e": {"KINESIS": "myapp-Kinesis-L6MUKT1VH451", "PROCESS": "worker", "RELEASE": "RXZMCQEPDKO", "LOG_FORMAT": "logplex"},
+		},
+		lines:         make(map[string][]*kinesis.PutRecordsRequestEntry),
+		partitionKeys: map[string]string{"myapp-Kinesis-L6MUKT1VH451": "hash"},
+		clientId:      "dev@convox.com",
+		tenantPrefix:  true,
+	}
+
+	// the same line from different containers, times and framing lands on one shard
+	m.parseAndForwardLine("8dfafdbc3a40", "2016-05-16T21:01:54.123456Z Hello from Docker.\n")
+	m.parseAndForwardLine("8dfafdbc3a40", "2016-05-16T21:01:55.654321Z Hello from Docker.\n")
+	m.parseAndForwardLine("977a93d4d48e", "2016-05-16T21:01:56.000001Z Hello from Docker.\n")
+	m.parseAndForwardLine("977a93d4d48e", "2016-05-16T21:01:57.000001Z Goodbye from Docker.\n")
+
+	lines := m.getLines("myapp-Kinesis-L6MUKT1VH451")
+	assert.Len(t, lines, 4)
+
+	key := partitionKey("hash", "", "", "", "Hello from Docker.")
+
+	assert.Equal(t, key, *lines[0].PartitionKey)
+	assert.Equal(t, key, *lines[1].PartitionKey)
+	assert.Equal(t, key, *lines[2].PartitionKey)
+	assert.NotEqual(t, key, *lines[3].PartitionKey)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+type scrubber struct {
+	name        string
+	pattern     *regexp.Regexp
+	replacement string
+	valid       func(match string) bool // optional check to reduce false positives
+}
+
+// PII scrubbers, applied in order. Cards run before phones so a card number
+// is never partially redacted as a phone number.
+var SCRUBBERS = []scrubber{
+	{
+		name:        "email",
+		pattern:     regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+		replacement: "[EMAIL]",
+	},
+	{
+		name:        "card",
+		pattern:     regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+		replacement: "[CARD]",
+		valid:       luhn,
+	},
+	{
+		// international numbers with a +country code, or US numbers with separators
+		// bare digit runs like 4155551234 are left alone so timestamps and ids survive
+		name:        "phone",
+		pattern:     regexp.MustCompile(`\+\d{1,3}(?:[-. ]?\(?\d{1,4}\)?){2,5}\b|(?:\(\d{3}\) ?|\b\d{3}[-. ])\d{3}[-. ]\d{4}\b`),
+		replacement: "[PHONE]",
+		valid:       phone,
+	},
+}
+
+// parseScrubbers picks scrubbers for a container SCRUB_PII setting,
+// either "all" (or "true" or "1") or a list like "email,card"
+// Unknown kinds are returned so they can be logged, and turn on every scrubber
+// so a typo never ships PII unredacted
+func parseScrubbers(kinds string) ([]scrubber, []string) {
+	enabled := map[string]bool{}
+	unknown := []string{}
+
+	known := map[string]bool{"all": true, "true": true, "1": true}
+
+	for _, s := range SCRUBBERS {
+		known[s.name] = true
+	}
+
+	for _, k := range strings.Split(kinds, ",") {
+		k = strings.TrimSpace(k)
+
+		if k == "" {
+			continue
+		}
+
+		if !known[k] {
+			unknown = append(unknown, k)
+			continue
+		}
+
+		enabled[k] = true
+	}
+
+	all := enabled["all"] || enabled["true"] || enabled["1"] || len(unknown) > 0
+
+	scrubbers := []scrubber{}
+
+	for _, s := range SCRUBBERS {
+		if all || enabled[s.name] {
+			scrubbers = append(scrubbers, s)
+		}
+	}
+
+	return scrubbers, unknown
+}
+
+// scrubLine redacts PII from a line
+func scrubLine(scrubbers []scrubber, line string) string {
+	for _, s := range scrubbers {
+		line = s.pattern.ReplaceAllStringFunc(line, func(match string) string {
+			if s.valid != nil && !s.valid(match) {
+				return match
+			}
+
+			return s.replacement
+		})
+	}
+
+	return line
+}
+
+// luhn validates the check digit of a card number, ignoring spaces and dashes
+// https://en.wikipedia.org/wiki/Luhn_algorithm
+func luhn(number string) bool {
+	sum := 0
+	double := false
+
+	digits := 0
+
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+
+		if c == ' ' || c == '-' {
+			continue
+		}
+
+		d := int(c - '0')
+
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+
+		sum += d
+		double = !double
+		digits += 1
+	}
+
+	return digits >= 13 && digits <= 19 && sum%10 == 0
+}
+
+// phone checks a match has as many digits as a real phone number
+func phone(number string) bool {
+	digits := 0
+
+	for _, c := range number {
+		if c >= '0' && c <= '9' {
+			digits += 1
+		}
+	}
+
+	return digits >= 8 && digits <= 15
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScrubLine(t *testing.T) {
+	line := "user=jane@example.com phone=(415) 555-1234 card=4111 1111 1111 1111 order=1234567890123"
+
+	none, _ := parseScrubbers("")
+	all, _ := parseScrubbers("all")
+	some, _ := parseScrubbers("email, card")
+
+	assert.Equal(t, line, scrubLine(none, line))
+	assert.Equal(t, "user=[EMAIL] phone=[PHONE] card=[CARD] order=1234567890123", scrubLine(all, line))
+	assert.Equal(t, "user=[EMAIL] phone=(415) 555-1234 card=[CARD] order=1234567890123", scrubLine(some, line))
+
+	phones, _ := parseScrubbers("phone")
+
+	assert.Equal(t, "call [PHONE] at 1463432514", scrubLine(phones, "call +1 415-555-1234 at 1463432514"))
+	assert.Equal(t, "call [PHONE] or [PHONE]", scrubLine(phones, "call +44 20 7946 0958 or +4915112345678"))
+	assert.Equal(t, "call 4155551234", scrubLine(phones, "call 4155551234"))
+	assert.Equal(t, "build +1 2", scrubLine(phones, "build +1 2"))
+}
+
+func TestParseScrubbers(t *testing.T) {
+	for _, kinds := range []string{"all", "true", "1"} {
+		scrubbers, unknown := parseScrubbers(kinds)
+		assert.Len(t, scrubbers, len(SCRUBBERS))
+		assert.Len(t, unknown, 0)
+	}
+
+	scrubbers, unknown := parseScrubbers("email,card")
+	assert.Len(t, scrubbers, 2)
+	assert.Len(t, unknown, 0)
+
+	// a typo must not turn scrubbing off
+	scrubbers, unknown = parseScrubbers("emails,card")
+	assert.Len(t, scrubbers, len(SCRUBBERS))
+	assert.Equal(t, []string{"emails"}, unknown)
+}
+
+func TestLuhn(t *testing.T) {
+	assert.True(t, luhn("4111111111111111"))
+	assert.True(t, luhn("5500-0000-0000-0004"))
+	assert.False(t, luhn("4111111111111112"))
+	assert.False(t, luhn("0000"))
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+var SLO_WINDOW = 24 * time.Hour
+var SLO_BUCKET = time.Hour
+
+// SLOTracker tracks delivery results and downtime windows per sink
+// so the agent can report "logs emitted -> logs queryable" availability
+type SLOTracker struct {
+	lock  sync.Mutex
+	sinks map[string]*sinkSLO
+}
+
+type sinkSLO struct {
+	buckets   []*sloBucket
+	downSince time.Time
+	downtimes []sloWindow
+}
+
+type sloBucket struct {
+	start     time.Time
+	delivered int64
+	failed    int64
+}
+
+type sloWindow struct {
+	start time.Time
+	end   time.Time
+}
+
+func NewSLOTracker() *SLOTracker {
+	return &SLOTracker{
+		sinks: make(map[string]*sinkSLO),
+	}
+}
+
+// Record the result of a delivery attempt to a sink
+// A sink is down from its first attempt where nothing was delivered until its next successful delivery
+func (s *SLOTracker) Record(sink string, delivered, failed int, at time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ss, ok := s.sinks[sink]
+	if !ok {
+		ss = &sinkSLO{}
+		s.sinks[sink] = ss
+	}
+
+	start := at.Truncate(SLO_BUCKET)
+
+	if n := len(ss.buckets); n == 0 || ss.buckets[n-1].start.Before(start) {
+		ss.buckets = append(ss.buckets, &sloBucket{start: start})
+	}
+
+	b := ss.buckets[len(ss.buckets)-1]
+	b.delivered += int64(delivered)
+	b.failed += int64(failed)
+
+	switch {
+	case delivered == 0 && failed > 0 && ss.downSince.IsZero():
+		ss.downSince = at
+	case delivered > 0 && !ss.downSince.IsZero():
+		ss.downtimes = append(ss.downtimes, sloWindow{ss.downSince, at})
+		ss.downSince = time.Time{}
+	}
+
+	ss.trim(at)
+}
+
+// Availability returns the delivery success percentage and downtime for a sink over the rolling window
+func (s *SLOTracker) Availability(sink string, now time.Time) (availability float64, downtime time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ss, ok := s.sinks[sink]
+	if !ok {
+		return 100, 0
+	}
+
+	ss.trim(now)
+
+	var delivered, failed int64
+
+	for _, b := range ss.buckets {
+		delivered += b.delivered
+		failed += b.failed
+	}
+
+	availability = 100
+
+	if delivered+failed > 0 {
+		availability = float64(delivered) / float64(delivered+failed) * 100
+	}
+
+	since := now.Add(-SLO_WINDOW)
+
+	windows := ss.downtimes
+	if !ss.downSince.IsZero() {
+		windows = append(windows[:len(windows):len(windows)], sloWindow{ss.downSince, now})
+	}
+
+	for _, w := range windows {
+		start := w.start
+		if start.Before(since) {
+			start = since
+		}
+
+		if w.end.After(start) {
+			downtime += w.end.Sub(start)
+		}
+	}
+
+	return availability, downtime
+}
+
+// Sinks returns every sink with recorded deliveries
+func (s *SLOTracker) Sinks() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sinks := []string{}
+
+	for sink, _ := range s.sinks {
+		sinks = append(sinks, sink)
+	}
+
+	sort.Strings(sinks)
+
+	return sinks
+}
+
+// trim drops buckets and downtime windows that fell out of the rolling window
+func (ss *sinkSLO) trim(now time.Time) {
+	since := now.Add(-SLO_WINDOW)
+
+	for len(ss.buckets) > 0 && !ss.buckets[0].start.Add(SLO_BUCKET).After(since) {
+		ss.buckets = ss.buckets[1:]
+	}
+
+	for len(ss.downtimes) > 0 && !ss.downtimes[0].end.After(since) {
+		ss.downtimes = ss.downtimes[1:]
+	}
+}
+
+// Report rolling availability per sink as metrics, and a daily summary event
+func (m *Monitor) SLO() {
+	m.logSystemf("slo at=start")
+
+	summarized := time.Now()
+
+	for _ = range time.Tick(MONITOR_INTERVAL) {
+		now := time.Now()
+		summary := now.Sub(summarized) >= 24*time.Hour
+
+		for _, sink := range m.slo.Sinks() {
+			availability, downtime := m.slo.Availability(sink, now)
+
+			m.logSystemf("slo sink=%s dim#sink=%s sample#slo.availability=%.4f%% sample#slo.downtime=%.0fs", sink, sink, availability, downtime.Seconds())
+
+			if summary {
+				// log for humans
+				m.logSystemf("who=\"convox/agent\" what=\"daily delivery summary\" sink=%s availability=%.4f%% downtime=%s window=%s", sink, availability, downtime, SLO_WINDOW)
+			}
+		}
+
+		if summary {
+			summarized = now
+		}
+	}
+}
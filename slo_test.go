@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSLOTracker(t *testing.T) {
+	s := NewSLOTracker()
+	now := time.Date(2016, 5, 16, 12, 0, 0, 0, time.UTC)
+
+	availability, downtime := s.Availability("kinesis:convox-Kinesis", now)
+	assert.Equal(t, 100.0, availability)
+	assert.Equal(t, time.Duration(0), downtime)
+
+	s.Record("kinesis:convox-Kinesis", 90, 0, now.Add(-3*time.Hour))
+	s.Record("kinesis:convox-Kinesis", 0, 10, now.Add(-2*time.Hour))
+	s.Record("kinesis:convox-Kinesis", 100, 0, now.Add(-1*time.Hour))
+
+	availability, downtime = s.Availability("kinesis:convox-Kinesis", now)
+	assert.InDelta(t, 95.0, availability, 0.0001)
+	assert.Equal(t, 1*time.Hour, downtime)
+
+	// an open downtime window counts up to now
+	s.Record("kinesis:convox-Kinesis", 0, 50, now.Add(-10*time.Minute))
+
+	_, downtime = s.Availability("kinesis:convox-Kinesis", now)
+	assert.Equal(t, 70*time.Minute, downtime)
+
+	// results fall out of the rolling window
+	availability, downtime = s.Availability("kinesis:convox-Kinesis", now.Add(SLO_WINDOW))
+	assert.Equal(t, 100.0, availability)
+	assert.Equal(t, SLO_WINDOW, downtime)
+
+	assert.Equal(t, []string{"kinesis:convox-Kinesis"}, s.Sinks())
+}
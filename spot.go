@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
@@ -12,6 +13,8 @@ import (
 	"github.com/aws/aws-sdk-go/aws/ec2metadata"
 )
 
+var ECS_METADATA_ENDPOINT = "http://localhost:51678/v1/metadata"
+
 func (m *Monitor) Spot() {
 	m.logSystemf("spot at=start")
 
@@ -34,33 +37,55 @@ func (m *Monitor) Spot() {
 					m.logSystemf("Unable to parse termination time")
 				} else {
 					m.logSystemf("Termination notice: %s", ts)
-					instanceArn := m.getECSMetadata("ContainerInstanceArn")
-					cluster := m.getECSMetadata("Cluster")
-					m.setInstanceDraining(instanceArn, cluster)
+					m.drainInstance()
 				}
 			}
 		}
 	}
 }
 
-func (m *Monitor) getECSMetadata(key string) string {
-	resp, err := http.Get("http://localhost:51678/v1/metadata")
+// drainInstance sets the ECS container instance to DRAINING so tasks are rescheduled elsewhere
+// It does nothing if the ECS agent can't say which instance and cluster this is
+func (m *Monitor) drainInstance() {
+	instanceArn, err := m.getECSMetadata("ContainerInstanceArn")
+	if err != nil {
+		m.logSystemf("Unable to fetch instance ARN: %s", err)
+		return
+	}
+
+	cluster, err := m.getECSMetadata("Cluster")
 	if err != nil {
-		m.logSystemf("Unable to fetch instance ARN")
+		m.logSystemf("Unable to fetch cluster: %s", err)
+		return
 	}
 
+	m.setInstanceDraining(instanceArn, cluster)
+}
+
+func (m *Monitor) getECSMetadata(key string) (string, error) {
+	resp, err := http.Get(ECS_METADATA_ENDPOINT)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		m.logSystemf("Unable to read metadata response body")
+		return "", err
 	}
 
 	var metadata map[string]interface{}
 
 	if err = json.Unmarshal(body, &metadata); err != nil {
-		m.logSystemf("Unable to decode JSON metadata")
+		return "", err
+	}
+
+	value, ok := metadata[key].(string)
+	if !ok || value == "" {
+		return "", fmt.Errorf("no %s in ECS metadata", key)
 	}
 
-	return metadata[key].(string)
+	return value, nil
 }
 
 func (m *Monitor) setInstanceDraining(instanceArn, cluster string) {
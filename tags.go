@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// characters that would break up a key=value pair in an event line or metric dimension
+var tagUnsafe = regexp.MustCompile(`[^A-Za-z0-9._@/+-]+`)
+
+type tag struct {
+	key   string
+	value string
+}
+
+// tenantTags identify the rack so shared logging accounts can partition data
+// without inferring from stream names. They are set on CloudWatch Logs groups.
+func (m *Monitor) tenantTags() []tag {
+	tags := []tag{}
+
+	if m.clientId != "" {
+		tags = append(tags, tag{"clientId", m.clientId})
+	}
+
+	if m.environment != "" {
+		tags = append(tags, tag{"environment", m.environment})
+	}
+
+	return tags
+}
+
+// tags returns tenant and instance tags attached to metrics and error reports
+func (m *Monitor) tags() []tag {
+	return append(m.tenantTags(), m.instanceTags...)
+}
+
+// describeInstanceTags looks up selected EC2 tags for this instance so dashboards can be sliced by cluster
+// There is no EC2 client in the vendored SDK, so this needs the aws cli installed in the image
+func (m *Monitor) describeInstanceTags(names []string) ([]tag, error) {
+	out, err := exec.Command("aws", "ec2", "describe-tags", "--region", m.region, "--filters", fmt.Sprintf("Name=resource-id,Values=%s", m.instanceId), "--output", "json").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	return parseInstanceTags(out, names)
+}
+
+// parseInstanceTags picks the named tags out of `aws ec2 describe-tags` output
+// Keys are namespaced as ec2.Name so an Environment tag can't collide with the environment tenant tag
+func parseInstanceTags(out []byte, names []string) ([]tag, error) {
+	var res struct {
+		Tags []struct {
+			Key   string
+			Value string
+		}
+	}
+
+	if err := json.Unmarshal(out, &res); err != nil {
+		return nil, err
+	}
+
+	values := map[string]string{}
+
+	for _, t := range res.Tags {
+		values[t.Key] = t.Value
+	}
+
+	tags := []tag{}
+
+	for _, name := range names {
+		if v, ok := values[name]; ok {
+			tags = append(tags, tag{"ec2." + name, v})
+		}
+	}
+
+	return tags, nil
+}
+
+// tagPrefix formats tags to lead an event line when opted in with TENANT_PREFIX=true
+// [clientId=dev@convox.com environment=staging]
+func (m *Monitor) tagPrefix() string {
+	tags := m.tags()
+
+	if !m.tenantPrefix || len(tags) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, len(tags))
+
+	for i, t := range tags {
+		pairs[i] = t.String()
+	}
+
+	return fmt.Sprintf("[%s] ", strings.Join(pairs, " "))
+}
+
+// tagDimensions formats tags as metric dimensions
+// dim#clientId=dev@convox.com dim#environment=staging
+func (m *Monitor) tagDimensions() string {
+	dims := []string{}
+
+	for _, t := range m.tags() {
+		dims = append(dims, "dim#"+t.String())
+	}
+
+	return strings.Join(dims, " ")
+}
+
+// String formats a tag as key=value with spaces, colons and other separators replaced
+// aws:autoscaling:groupName=convox Cluster -> aws_autoscaling_groupName=convox_Cluster
+func (t tag) String() string {
+	return fmt.Sprintf("%s=%s", tagUnsafe.ReplaceAllString(t.key, "_"), tagUnsafe.ReplaceAllString(t.value, "_"))
+}
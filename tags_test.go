@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTags(t *testing.T) {
+	m := &Monitor{}
+
+	assert.Equal(t, "", m.tagPrefix())
+	assert.Equal(t, "", m.tagDimensions())
+
+	m.clientId = "dev@convox.com"
+	m.environment = "staging"
+
+	// event lines are only prefixed when opted in
+	assert.Equal(t, "", m.tagPrefix())
+
+	m.tenantPrefix = true
+
+	assert.Equal(t, "[clientId=dev@convox.com environment=staging] ", m.tagPrefix())
+	assert.Equal(t, "dim#clientId=dev@convox.com dim#environment=staging", m.tagDimensions())
+
+	m.instanceTags = []tag{{"ec2.Cluster", "convox-Cluster-1NCWX9EC0JOV4"}, {"ec2.aws:autoscaling:groupName", "convox Instances"}}
+
+	assert.Equal(t, "[clientId=dev@convox.com environment=staging ec2.Cluster=convox-Cluster-1NCWX9EC0JOV4 ec2.aws_autoscaling_groupName=convox_Instances] ", m.tagPrefix())
+	assert.Equal(t, "dim#clientId=dev@convox.com dim#environment=staging dim#ec2.Cluster=convox-Cluster-1NCWX9EC0JOV4 dim#ec2.aws_autoscaling_groupName=convox_Instances", m.tagDimensions())
+}
+
+func TestParseInstanceTags(t *testing.T) {
+	out := []byte(`{
+    "Tags": [
+        {"ResourceType": "instance", "ResourceId": "i-553ffcd2", "Value": "convox-Cluster-1NCWX9EC0JOV4", "Key": "Cluster"},
+        {"ResourceType": "instance", "ResourceId": "i-553ffcd2", "Value": "production", "Key": "Environment"},
+        {"ResourceType": "instance", "ResourceId": "i-553ffcd2", "Value": "convox-Instances-1QK4UO5DKZJRQ", "Key": "aws:autoscaling:groupName"}
+    ]
+}`)
+
+	tags, err := parseInstanceTags(out, []string{"Environment", "Team", "Cluster"})
+	assert.Nil(t, err)
+	assert.Equal(t, []tag{{"ec2.Environment", "production"}, {"ec2.Cluster", "convox-Cluster-1NCWX9EC0JOV4"}}, tags)
+
+	_, err = parseInstanceTags([]byte("not json"), []string{"Cluster"})
+	assert.NotNil(t, err)
+}
+
+func TestTagPrefixScrubbed(t *testing.T) {
+	scrubbers, _ := parseScrubbers("all")
+
+	m := &Monitor{
+		envs: map[string]map[string]string{
+			"977a93d4d48e": {"KINESIS": "myapp-Kinesis-L6MUKT1VH451", "PROCESS": "web", "RELEASE": "RXZMCQEPDKO"},
+		},
+		scrubbers:    map[string][]scrubber{"977a93d4d48e": scrubbers},
+		lines:        make(map[string][]*kinesis.PutRecordsRequestEntry),
+		clientId:     "dev@convox.com",
+		tenantPrefix: true,
+	}
+
+	m.parseAndForwardLine("977a93d4d48e", "2016-05-16T21:01:54.123456Z signup user=jane@example.com\n")
+
+	lines := m.getLines("myapp-Kinesis-L6MUKT1VH451")
+	assert.Len(t, lines, 1)
+	assert.Equal(t, "2016-05-16 21:01:54 web:RXZMCQEPDKO/977a93d4d48e [clientId=dev@convox.com] signup user=[EMAIL]", string(lines[0].Data))
+}